@@ -2,9 +2,15 @@ package Item
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
 	"sg_interpreter/src/sg/ast"
+	"sg_interpreter/src/sg/code"
+	"sg_interpreter/src/sg/token"
+	"strconv"
 	"strings"
 )
 
@@ -19,18 +25,49 @@ const (
 	NULL_ITEM    = "NULL"
 	ERROR_ITEM   = "ERROR"
 	INTEGER_ITEM = "INTEGER"
+	BIGINT_ITEM  = "BIGINT"
+	FLOAT_ITEM   = "FLOAT"
 	BOOLEAN_ITEM = "BOOLEAN"
 	STRING_ITEM  = "STRING"
 
-	FUNCTION_ITEM     = "FUNCTION"
-	RETURN_VALUE_ITEM = "RETURN_VALUE"
+	FUNCTION_ITEM          = "FUNCTION"
+	COMPILED_FUNCTION_ITEM = "COMPILED_FUNCTION"
+	CELL_ITEM              = "CELL"
+	RETURN_VALUE_ITEM      = "RETURN_VALUE"
+	BREAK_ITEM             = "BREAK"
+	CONTINUE_ITEM          = "CONTINUE"
 
 	BUILTIN_ITEM = "BUILTIN"
 
-	ARRAY_ITEM = "ARRAY"
-	HASH_ITEM  = "HASH"
+	ARRAY_ITEM    = "ARRAY"
+	HASH_ITEM     = "HASH"
+	RANGE_ITEM    = "RANGE"
+	ITERATOR_ITEM = "ITERATOR"
+	MODULE_ITEM   = "MODULE"
+
+	ERROR_VALUE_ITEM = "ERROR_VALUE"
 )
 
+// The kinds of errors, which a program can tell apart once it caught one.
+const (
+	GENERIC_ERROR   = "Error"
+	TYPE_ERROR      = "TypeError"
+	NAME_ERROR      = "NameError"
+	INDEX_ERROR     = "IndexError"
+	VALUE_ERROR     = "ValueError"
+	ARGUMENT_ERROR  = "ArgumentError"
+	ZERO_DIVISION   = "ZeroDivisionError"
+	OVERFLOW_ERROR  = "OverflowError"
+	RECURSION_ERROR = "RecursionError"
+	IMPORT_ERROR    = "ImportError"
+	INTERNAL_ERROR  = "InternalError"
+)
+
+// MaxNesting is how deeply arrays and hashes inside each other are followed
+// when they are printed, compared or made into keys, far less deeply than the
+// Go stack could follow them.
+const MaxNesting = 1 << 14
+
 type HashKey struct {
 	Type  ItemType
 	Value uint64
@@ -54,6 +91,68 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// BigInt holds the integers that do not fit in an Integer. Arithmetic only
+// produces a BigInt when the result is out of the int64 range, so the same
+// number is never an Integer in one place and a BigInt in another.
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ItemType {
+	return BIGINT_ITEM
+}
+func (b *BigInt) Output() string {
+	return b.Value.String()
+}
+func (b *BigInt) HashKey() HashKey {
+	if b.Value.IsInt64() {
+		return (&Integer{Value: b.Value.Int64()}).HashKey()
+	}
+	h := fnv.New64a()
+	h.Write([]byte(b.Value.String()))
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ItemType {
+	return FLOAT_ITEM
+}
+
+// Output prints the shortest text that reads back as the same float, and
+// always marks it as a float so 2.0 does not print like the integer 2.
+func (f *Float) Output() string {
+	format := byte('f')
+	if abs := math.Abs(f.Value); abs != 0 && (abs < 1e-4 || abs >= 1e21) {
+		format = 'g'
+	}
+	s := strconv.FormatFloat(f.Value, format, -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// HashKey of a float with an integer value is the integer's, since the two
+// are equal and so must be the same key. 0.0 and -0.0 are both 0.
+func (f *Float) HashKey() HashKey {
+	if whole, ok := floatInt(f.Value); ok {
+		return (&BigInt{Value: whole}).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
+// floatInt returns the integer value of f, if it has one.
+func floatInt(f float64) (*big.Int, bool) {
+	if math.IsInf(f, 0) || f != math.Trunc(f) {
+		return nil, false
+	}
+	whole, _ := big.NewFloat(f).Int(nil)
+	return whole, true
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -95,19 +194,101 @@ func (returnValue *ReturnValue) Type() ItemType {
 	return RETURN_VALUE_ITEM
 }
 
+// Break and Continue unwind the statements of a loop body, the same way
+// ReturnValue unwinds a function body. Pos is where the statement is, for
+// the error when there is no loop to leave.
+type Break struct {
+	Pos token.Position
+}
+
+func (b *Break) Type() ItemType { return BREAK_ITEM }
+func (b *Break) Output() string { return "break" }
+
+type Continue struct {
+	Pos token.Position
+}
+
+func (c *Continue) Type() ItemType { return CONTINUE_ITEM }
+func (c *Continue) Output() string { return "continue" }
+
+// Error is a raised error, it unwinds the program until a try statement
+// catches it as an ErrorValue.
 type Error struct {
+	Kind    string // GENERIC_ERROR when empty
 	Message string
+	Pos     token.Position
+	Trace   []StackFrame // innermost call first
+}
+
+// StackFrame is a function call an error unwound through.
+type StackFrame struct {
+	Function string
+	CallPos  token.Position
 }
 
 func (error *Error) Type() ItemType {
 	return ERROR_ITEM
 }
 func (error *Error) Output() string {
+	if error.Pos.IsValid() {
+		return "ERROR: " + error.Pos.String() + ": " + error.Message
+	}
 	return "ERROR: " + error.Message
 }
 
+// Value is the error as a program sees it after catching it.
+func (error *Error) Value() *ErrorValue {
+	kind := error.Kind
+	if kind == "" {
+		kind = GENERIC_ERROR
+	}
+	return &ErrorValue{Kind: kind, Message: error.Message, Pos: error.Pos, Trace: error.Trace}
+}
+
+// ErrorValue is an error as a value, made by error() or caught by a try
+// statement. Throwing it raises it again.
+type ErrorValue struct {
+	Kind    string
+	Message string
+	Pos     token.Position // invalid until the error is thrown
+	Trace   []StackFrame
+}
+
+func (e *ErrorValue) Type() ItemType { return ERROR_VALUE_ITEM }
+func (e *ErrorValue) Output() string { return e.Kind + ": " + e.Message }
+
+// Raise turns the value back into an error that unwinds the program.
+func (e *ErrorValue) Raise() *Error {
+	return &Error{Kind: e.Kind, Message: e.Message, Pos: e.Pos, Trace: append([]StackFrame(nil), e.Trace...)}
+}
+
+// Traceback is Output followed by the calls the error unwound through.
+// Runs of identical frames, as left behind by deep recursion, are folded.
+func (error *Error) Traceback() string {
+	var out bytes.Buffer
+	out.WriteString(error.Output())
+	if len(error.Trace) == 0 {
+		return out.String()
+	}
+	out.WriteString("\nTraceback (most recent call first):")
+	for i := 0; i < len(error.Trace); {
+		frame := error.Trace[i]
+		repeated := 1
+		for i+repeated < len(error.Trace) && error.Trace[i+repeated] == frame {
+			repeated++
+		}
+		out.WriteString(fmt.Sprintf("\n  in %s, called at %s", frame.Function, frame.CallPos))
+		if repeated > 1 {
+			out.WriteString(fmt.Sprintf("\n  [previous call repeated %d more times]", repeated-1))
+		}
+		i += repeated
+	}
+	return out.String()
+}
+
 type Function struct {
-	Parameters []*ast.Identifier
+	Name       string
+	Parameters []*ast.Parameter
 	Body       *ast.BlockStatement
 	Scope      *Scope
 }
@@ -116,20 +297,88 @@ func (function *Function) Type() ItemType {
 	return FUNCTION_ITEM
 }
 func (function *Function) Output() string {
+	return functionOutput(function.Parameters, function.Body)
+}
+
+func functionOutput(parameters []*ast.Parameter, body *ast.BlockStatement) string {
 	var out bytes.Buffer
 	params := []string{}
-	for _, p := range function.Parameters {
+	for _, p := range parameters {
 		params = append(params, p.String())
 	}
 	out.WriteString("fun")
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
-	out.WriteString(function.Body.String())
+	out.WriteString(body.String())
 	out.WriteString("\n}")
 	return out.String()
 }
 
+// CompiledFunction is a function body lowered to bytecode by the compiler.
+// Parameters and Body are kept so it prints the same way as a Function.
+type CompiledFunction struct {
+	Name          string
+	Instructions  code.Instructions
+	Positions     code.PositionTable
+	NumLocals     int
+	NumParameters int
+	Parameters    []*ast.Parameter
+	Body          *ast.BlockStatement
+}
+
+func (cf *CompiledFunction) Type() ItemType { return COMPILED_FUNCTION_ITEM }
+func (cf *CompiledFunction) Output() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Cell is a variable slot of the vm. Closures capture cells rather than
+// values, so assignments are seen by every function sharing the variable.
+type Cell struct {
+	Value Item
+}
+
+func (c *Cell) Type() ItemType { return CELL_ITEM }
+func (c *Cell) Output() string {
+	if c.Value == nil {
+		return "null"
+	}
+	return c.Value.Output()
+}
+
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Cell
+	// Globals are those of the file the function was defined in.
+	Globals *Globals
+}
+
+func (c *Closure) Type() ItemType { return FUNCTION_ITEM }
+func (c *Closure) Output() string {
+	return functionOutput(c.Fn.Parameters, c.Fn.Body)
+}
+
+// Globals are the variables at the top level of a file the vm runs, the
+// program or a module. Names[i] is the name of Values[i], which is nil until
+// the variable is defined.
+type Globals struct {
+	Values []Item
+	Names  []string
+}
+
+func NewGlobals(names []string) *Globals {
+	return &Globals{Values: make([]Item, len(names)), Names: names}
+}
+
+func (g *Globals) Get(name string) (Item, bool) {
+	for i, globalName := range g.Names {
+		if globalName == name && g.Values[i] != nil {
+			return g.Values[i], true
+		}
+	}
+	return nil, false
+}
+
 type String struct {
 	Value string
 }
@@ -144,8 +393,21 @@ func (s *String) HashKey() HashKey {
 
 type BuiltinFunction func(args ...Item) Item
 
+// Caller calls a function value, whichever engine made it, for the builtins
+// that take functions as arguments.
+type Caller func(fn Item, args ...Item) Item
+
 type Builtin struct {
 	Fn BuiltinFunction
+	// CallbackFn is used instead of Fn when it is set.
+	CallbackFn func(call Caller, args ...Item) Item
+}
+
+func (b *Builtin) Call(call Caller, args ...Item) Item {
+	if b.CallbackFn != nil {
+		return b.CallbackFn(call, args...)
+	}
+	return b.Fn(args...)
 }
 
 func (b *Builtin) Type() ItemType { return BUILTIN_ITEM }
@@ -158,20 +420,55 @@ type Array struct {
 }
 
 func (ao *Array) Type() ItemType { return ARRAY_ITEM }
-func (ao *Array) Output() string {
-	var out bytes.Buffer
 
-	elements := []string{}
+// Output prints an array or hash that contains itself as [...] or {...}
+// where it appears inside itself again, and the same for values nested more
+// than MaxNesting levels deep.
+func (ao *Array) Output() string {
+	return output(ao, make(map[Item]bool))
+}
 
-	for i := int64(0); i < ao.Len; i++ {
-		elements = append(elements, ao.Elements[i].Output())
+// output prints item, path holds the arrays and hashes it is inside of.
+func output(item Item, path map[Item]bool) string {
+	switch item := item.(type) {
+	case *Array:
+		if path[item] || len(path) >= MaxNesting {
+			return "[...]"
+		}
+		path[item] = true
+		defer delete(path, item)
+		elements := make([]string, item.Len)
+		for i, element := range item.Elements[:item.Len] {
+			elements[i] = output(element, path)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *Hash:
+		if path[item] || len(path) >= MaxNesting {
+			return "{...}"
+		}
+		path[item] = true
+		defer delete(path, item)
+		pairs := []string{}
+		for _, pair := range item.Pairs() {
+			pairs = append(pairs, output(pair.Key, path)+": "+output(pair.Value, path))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
 	}
+	return item.Output()
+}
 
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
-
-	return out.String()
+// HashKey combines the keys of the elements, so it may only be called on
+// arrays that ToKey returned.
+func (ao *Array) HashKey() HashKey {
+	h := fnv.New64a()
+	var value [8]byte
+	for _, element := range ao.Elements[:ao.Len] {
+		key := element.(Hashable).HashKey()
+		h.Write([]byte(key.Type))
+		binary.LittleEndian.PutUint64(value[:], key.Value)
+		h.Write(value[:])
+	}
+	return HashKey{Type: ao.Type(), Value: h.Sum64()}
 }
 
 type HashPair struct {
@@ -179,23 +476,251 @@ type HashPair struct {
 	Value Item
 }
 
+// Hash keeps its pairs in the order their keys were first inserted, which is
+// the order they are printed and iterated in. Deleted pairs leave a hole in
+// pairs until there are more holes than pairs.
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	index   map[HashKey][]int // positions in pairs of the keys with that hash
+	pairs   []HashPair        // a deleted pair has a nil Key
+	size    int
+	deleted int
+}
+
+func NewHash() *Hash {
+	return &Hash{index: make(map[HashKey][]int)}
 }
 
 func (h *Hash) Type() ItemType { return HASH_ITEM }
+
+func (h *Hash) Len() int {
+	return h.size
+}
+
+// find returns the hash of key, and the place of key in its bucket and in
+// pairs, which are -1 when key is not there.
+func (h *Hash) find(key Hashable) (HashKey, int, int) {
+	hashKey := key.HashKey()
+	for j, i := range h.index[hashKey] {
+		if sameKey(h.pairs[i].Key, key.(Item)) {
+			return hashKey, j, i
+		}
+	}
+	return hashKey, -1, -1
+}
+
+func (h *Hash) Get(key Hashable) (Item, bool) {
+	_, _, i := h.find(key)
+	if i < 0 {
+		return nil, false
+	}
+	return h.pairs[i].Value, true
+}
+
+// Set replaces the value of a key that is already there, keeping its
+// position, or adds the pair at the end.
+func (h *Hash) Set(key Hashable, value Item) {
+	hashKey, _, i := h.find(key)
+	if i >= 0 {
+		h.pairs[i].Value = value
+		return
+	}
+	h.index[hashKey] = append(h.index[hashKey], len(h.pairs))
+	h.pairs = append(h.pairs, HashPair{Key: key.(Item), Value: value})
+	h.size++
+}
+
+// Delete removes key and reports whether it was there.
+func (h *Hash) Delete(key Hashable) bool {
+	hashKey, j, i := h.find(key)
+	if i < 0 {
+		return false
+	}
+	if bucket := h.index[hashKey]; len(bucket) == 1 {
+		delete(h.index, hashKey)
+	} else {
+		h.index[hashKey] = append(bucket[:j:j], bucket[j+1:]...)
+	}
+	h.pairs[i] = HashPair{}
+	h.size--
+	h.deleted++
+	if h.deleted > h.size {
+		h.compact()
+	}
+	return true
+}
+
+func (h *Hash) compact() {
+	pairs := make([]HashPair, 0, h.size)
+	h.index = make(map[HashKey][]int, h.size)
+	for _, pair := range h.pairs {
+		if pair.Key != nil {
+			hashKey := pair.Key.(Hashable).HashKey()
+			h.index[hashKey] = append(h.index[hashKey], len(pairs))
+			pairs = append(pairs, pair)
+		}
+	}
+	h.pairs = pairs
+	h.deleted = 0
+}
+
+// Pairs returns a copy of the pairs in insertion order. Array keys are copied
+// too, so changing them does not change the hash.
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, h.size)
+	for _, pair := range h.pairs {
+		if pair.Key != nil {
+			if _, ok := pair.Key.(*Array); ok {
+				key, _ := ToKey(pair.Key)
+				pair.Key = key.(Item)
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// ToKey returns item as a hash key, or the error why it can't be one. Numbers
+// other than NaN, strings and booleans are keys as they are. An array is a key when all of
+// its elements are; it is copied, so changing the array later does not
+// change the hashes it is a key of.
+func ToKey(item Item) (Hashable, *Error) {
+	return toKey(item, item, make(map[*Array]bool))
+}
+
+// toKey copies arrays, path holds the arrays being copied so one that
+// contains itself is refused instead of copied forever. whole is the item
+// ToKey was given, which errors name.
+func toKey(item, whole Item, path map[*Array]bool) (Hashable, *Error) {
+	arr, ok := item.(*Array)
+	if !ok {
+		if f, isFloat := item.(*Float); isFloat && math.IsNaN(f.Value) {
+			// NaN is not equal to itself, it could never be found again
+			return nil, unusableKey(whole)
+		}
+		if key, ok := item.(Hashable); ok {
+			return key, nil
+		}
+		return nil, unusableKey(whole)
+	}
+	if path[arr] {
+		return nil, unusableKey(whole)
+	}
+	if len(path) >= MaxNesting {
+		return nil, &Error{Kind: RECURSION_ERROR, Message: fmt.Sprintf("hash key nested more than %d levels deep", MaxNesting)}
+	}
+	path[arr] = true
+	defer delete(path, arr)
+	elements := make([]Item, arr.Len)
+	for i, element := range arr.Elements[:arr.Len] {
+		key, err := toKey(element, whole, path)
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = key.(Item)
+	}
+	return &Array{Elements: elements, Len: arr.Len, Capacity: arr.Len}, nil
+}
+
+func unusableKey(item Item) *Error {
+	return &Error{Kind: TYPE_ERROR, Message: "unusable as hash key: " + string(item.Type())}
+}
+
+// sameKey reports whether two keys with the same HashKey are the same key,
+// rather than a collision. Numbers are the same key when == says they are
+// equal, whatever their types.
+func sameKey(a, b Item) bool {
+	if a == b {
+		return true
+	}
+	switch a := a.(type) {
+	case *Integer:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == b.Value
+		case *BigInt:
+			return b.Value.IsInt64() && b.Value.Int64() == a.Value
+		case *Float:
+			whole, ok := floatInt(b.Value)
+			return ok && whole.IsInt64() && whole.Int64() == a.Value
+		}
+	case *BigInt:
+		switch b := b.(type) {
+		case *Integer:
+			return sameKey(b, a)
+		case *BigInt:
+			return a.Value.Cmp(b.Value) == 0
+		case *Float:
+			whole, ok := floatInt(b.Value)
+			return ok && whole.Cmp(a.Value) == 0
+		}
+	case *Float:
+		switch b := b.(type) {
+		case *Integer, *BigInt:
+			return sameKey(b, a)
+		case *Float:
+			return a.Value == b.Value
+		}
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || a.Len != b.Len {
+			return false
+		}
+		for i := int64(0); i < a.Len; i++ {
+			if !sameKey(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 func (h *Hash) Output() string {
-	var out bytes.Buffer
+	return output(h, make(map[Item]bool))
+}
 
-	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			pair.Key.Output(), pair.Value.Output()))
+// FunctionName is the name used for fn in tracebacks.
+func FunctionName(name string) string {
+	if name == "" {
+		return "<anonymous>"
 	}
+	return name
+}
 
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
+// Range is the lazy sequence Start, Start+Step, ... that stops before Stop.
+type Range struct {
+	Start int64
+	Stop  int64
+	Step  int64
+}
 
-	return out.String()
+func (r *Range) Type() ItemType { return RANGE_ITEM }
+func (r *Range) Output() string {
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.Stop, r.Step)
+}
+
+func (r *Range) Len() int64 {
+	var distance, step uint64
+	switch {
+	case r.Step > 0 && r.Start < r.Stop:
+		distance, step = uint64(r.Stop)-uint64(r.Start), uint64(r.Step)
+	case r.Step < 0 && r.Start > r.Stop:
+		distance, step = uint64(r.Start)-uint64(r.Stop), uint64(-r.Step)
+	default:
+		return 0
+	}
+	length := distance / step
+	if distance%step != 0 {
+		length++
+	}
+	if length > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(length)
 }
@@ -0,0 +1,64 @@
+package Item
+
+// Iterator walks an iterable item for a for-in loop. Every step yields a key
+// and a value: the index and element of arrays, strings and ranges, or the
+// key and value of a hash.
+type Iterator struct {
+	// Keys tells whether a loop with a single variable binds the key,
+	// which is the case for hashes.
+	Keys bool
+	next func() (Item, Item, bool)
+}
+
+func (it *Iterator) Type() ItemType { return ITERATOR_ITEM }
+func (it *Iterator) Output() string { return "iterator" }
+
+func (it *Iterator) Next() (key Item, value Item, ok bool) {
+	return it.next()
+}
+
+// NewIterator returns an iterator over item, or false if item can't be
+// iterated.
+func NewIterator(item Item) (*Iterator, bool) {
+	i := int64(0)
+	switch item := item.(type) {
+	case *Array:
+		return &Iterator{next: func() (Item, Item, bool) {
+			if i >= item.Len {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: i - 1}, item.Elements[i-1], true
+		}}, true
+	case *String:
+		// like len and indexing, a loop goes over the bytes of a string, a
+		// character UTF-8 encodes in several comes one byte at a time
+		return &Iterator{next: func() (Item, Item, bool) {
+			if i >= int64(len(item.Value)) {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: i - 1}, &String{Value: item.Value[i-1 : i]}, true
+		}}, true
+	case *Range:
+		length := item.Len()
+		return &Iterator{next: func() (Item, Item, bool) {
+			if i >= length {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: i - 1}, &Integer{Value: item.Start + (i-1)*item.Step}, true
+		}}, true
+	case *Hash:
+		// changes to the hash during the loop are not seen by it
+		pairs := item.Pairs()
+		return &Iterator{Keys: true, next: func() (Item, Item, bool) {
+			if i >= int64(len(pairs)) {
+				return nil, nil, false
+			}
+			i++
+			return pairs[i-1].Key, pairs[i-1].Value, true
+		}}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,75 @@
+package Item
+
+import "strings"
+
+// Module is an imported file. Other files only see the names it exports.
+type Module struct {
+	Name      string
+	Path      string
+	Variables Variables
+	Exports   map[string]bool
+}
+
+// Variables are where a module keeps its variables, a *Scope when the
+// evaluator ran it and *Globals when the vm did.
+type Variables interface {
+	Get(name string) (Item, bool)
+}
+
+func (m *Module) Type() ItemType { return MODULE_ITEM }
+func (m *Module) Output() string { return "<module " + m.Name + ">" }
+
+// Modules keeps track of the files a program imports, so that each is
+// evaluated only once and import cycles are caught.
+type Modules struct {
+	// Globals is the scope modules are evaluated in, it holds what the host
+	// provides to every file.
+	Globals *Scope
+	// SearchPath lists the directories searched for modules that are not
+	// found next to the file importing them.
+	SearchPath []string
+
+	loaded  map[string]*Module
+	loading []loadingModule // each imported by the one before it
+}
+
+type loadingModule struct {
+	path string
+	name string // how the path is shown in errors
+}
+
+func NewModules(globals *Scope, searchPath []string) *Modules {
+	return &Modules{Globals: globals, SearchPath: searchPath, loaded: make(map[string]*Module)}
+}
+
+// Loaded returns the module of the file at path if it was imported before.
+func (m *Modules) Loaded(path string) (*Module, bool) {
+	module, ok := m.loaded[path]
+	return module, ok
+}
+
+// Begin marks the file at path as being evaluated. It fails with the chain
+// of imports when the file is already being evaluated, which means it
+// imports itself. name is the path as shown in that chain.
+func (m *Modules) Begin(path, name string) (cycle string, ok bool) {
+	for i, loading := range m.loading {
+		if loading.path == path {
+			var names []string
+			for _, module := range m.loading[i:] {
+				names = append(names, module.name)
+			}
+			return strings.Join(append(names, name), " -> "), false
+		}
+	}
+	m.loading = append(m.loading, loadingModule{path: path, name: name})
+	return "", true
+}
+
+// End records the outcome of evaluating the file Begin was last called for,
+// module is nil when it failed.
+func (m *Modules) End(path string, module *Module) {
+	m.loading = m.loading[:len(m.loading)-1]
+	if module != nil {
+		m.loaded[path] = module
+	}
+}
@@ -3,6 +3,13 @@ package Item
 type Scope struct {
 	Mp    map[string]Item
 	outer *Scope
+
+	// CallDepth counts the function calls that are running when code in
+	// this scope runs, the evaluator uses it to stop runaway recursion.
+	CallDepth int
+
+	// Modules are the files the program imported, shared by all its scopes.
+	Modules *Modules
 }
 
 func NewScope() *Scope {
@@ -13,6 +20,8 @@ func NewScope() *Scope {
 func NewEnclosedScope(outer *Scope) *Scope {
 	s := NewScope()
 	s.outer = outer
+	s.CallDepth = outer.CallDepth
+	s.Modules = outer.Modules
 	return s
 }
 
@@ -28,3 +37,15 @@ func (scope *Scope) Set(key string, item Item) Item {
 	scope.Mp[key] = item
 	return item
 }
+
+// Assign updates the nearest existing binding of key and reports whether
+// there was one.
+func (scope *Scope) Assign(key string, item Item) bool {
+	for s := scope; s != nil; s = s.outer {
+		if _, ok := s.Mp[key]; ok {
+			s.Mp[key] = item
+			return true
+		}
+	}
+	return false
+}
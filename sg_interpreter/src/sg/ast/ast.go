@@ -2,13 +2,16 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"sg_interpreter/src/sg/token"
+	"strconv"
 	"strings"
 )
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -30,6 +33,7 @@ type Identifier struct {
 }
 
 func (i *Identifier) expressionNode()      {}
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 func (i *Identifier) String() string       { return i.Value }
 
@@ -41,6 +45,13 @@ func (program *Program) TokenLiteral() string {
 	}
 }
 
+func (program *Program) Pos() token.Position {
+	if len(program.Statements) > 0 {
+		return program.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (program *Program) String() string {
 	var output bytes.Buffer
 	for _, s := range program.Statements {
@@ -49,19 +60,24 @@ func (program *Program) String() string {
 	return output.String()
 }
 
+// SetStatement assigns to a variable or, when Target is an IndexExpression,
+// to an element of an array or hash. Operator is set for compound
+// assignments to an element, `a[i] += v`, which evaluate a and i only once;
+// `x += v` is turned into `x = x + v` instead.
 type SetStatement struct {
-	Token token.Token
-	Id    *Identifier
-	Val   Expression
+	Token    token.Token
+	Target   Expression // *Identifier or *IndexExpression
+	Operator string
+	Val      Expression
 }
 
 func (setStatement *SetStatement) statementNode()       {}
+func (setStatement *SetStatement) Pos() token.Position  { return setStatement.Token.Pos }
 func (setStatement *SetStatement) TokenLiteral() string { return setStatement.Token.Literal }
 func (setStatement *SetStatement) String() string {
 	var output bytes.Buffer
-	output.WriteString(setStatement.TokenLiteral() + " ")
-	output.WriteString(setStatement.Id.String())
-	output.WriteString(" = ")
+	output.WriteString(setStatement.Target.String())
+	output.WriteString(" " + setStatement.Operator + "= ")
 	if setStatement.Val != nil {
 		output.WriteString(setStatement.Val.String())
 	}
@@ -76,6 +92,7 @@ type LetStatement struct {
 }
 
 func (letStatement *LetStatement) statementNode()       {}
+func (letStatement *LetStatement) Pos() token.Position  { return letStatement.Token.Pos }
 func (letStatement *LetStatement) TokenLiteral() string { return letStatement.Token.Literal }
 func (letStatement *LetStatement) String() string {
 	var output bytes.Buffer
@@ -95,6 +112,7 @@ type ReturnStatement struct {
 }
 
 func (returnStatement *ReturnStatement) statementNode()       {}
+func (returnStatement *ReturnStatement) Pos() token.Position  { return returnStatement.Token.Pos }
 func (returnStatement *ReturnStatement) TokenLiteral() string { return returnStatement.Token.Literal }
 func (returnStatement *ReturnStatement) String() string {
 	var output bytes.Buffer
@@ -112,6 +130,9 @@ type ExpressionStatement struct {
 }
 
 func (expressionStatement *ExpressionStatement) statementNode() {}
+func (expressionStatement *ExpressionStatement) Pos() token.Position {
+	return expressionStatement.Token.Pos
+}
 func (expressionStatement *ExpressionStatement) TokenLiteral() string {
 	return expressionStatement.Token.Literal
 }
@@ -128,6 +149,7 @@ type BlockStatement struct {
 }
 
 func (blockStatement *BlockStatement) statementNode()       {}
+func (blockStatement *BlockStatement) Pos() token.Position  { return blockStatement.Token.Pos }
 func (blockStatement *BlockStatement) TokenLiteral() string { return blockStatement.Token.Literal }
 func (blockStatement *BlockStatement) String() string {
 	var output bytes.Buffer
@@ -143,18 +165,31 @@ type Boolean struct {
 }
 
 func (boolean *Boolean) expressionNode()      {}
+func (boolean *Boolean) Pos() token.Position  { return boolean.Token.Pos }
 func (boolean *Boolean) TokenLiteral() string { return boolean.Token.Literal }
 func (boolean *Boolean) String() string       { return boolean.Token.Literal }
 
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // set instead of Value when the literal does not fit in an int64
 }
 
 func (integerLiteral *IntegerLiteral) expressionNode()      {}
+func (integerLiteral *IntegerLiteral) Pos() token.Position  { return integerLiteral.Token.Pos }
 func (integerLiteral *IntegerLiteral) TokenLiteral() string { return integerLiteral.Token.Literal }
 func (integerLiteral *IntegerLiteral) String() string       { return integerLiteral.Token.Literal }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (floatLiteral *FloatLiteral) expressionNode()      {}
+func (floatLiteral *FloatLiteral) Pos() token.Position  { return floatLiteral.Token.Pos }
+func (floatLiteral *FloatLiteral) TokenLiteral() string { return floatLiteral.Token.Literal }
+func (floatLiteral *FloatLiteral) String() string       { return floatLiteral.Token.Literal }
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -162,6 +197,7 @@ type PrefixExpression struct {
 }
 
 func (expression *PrefixExpression) expressionNode()      {}
+func (expression *PrefixExpression) Pos() token.Position  { return expression.Token.Pos }
 func (expression *PrefixExpression) TokenLiteral() string { return expression.Token.Literal }
 func (expression *PrefixExpression) String() string {
 	var output bytes.Buffer
@@ -182,6 +218,7 @@ type InfixExpression struct {
 }
 
 func (expression *InfixExpression) expressionNode()      {}
+func (expression *InfixExpression) Pos() token.Position  { return expression.Token.Pos }
 func (expression *InfixExpression) TokenLiteral() string { return expression.Token.Literal }
 func (expression *InfixExpression) String() string {
 	var output bytes.Buffer
@@ -201,25 +238,49 @@ type IfExpression struct {
 }
 
 func (ifExpression *IfExpression) expressionNode()      {}
+func (ifExpression *IfExpression) Pos() token.Position  { return ifExpression.Token.Pos }
 func (ifExpression *IfExpression) TokenLiteral() string { return ifExpression.Token.Literal }
 func (ifExpression *IfExpression) String() string {
 	var output bytes.Buffer
-	output.WriteString("if")
-	output.WriteString(ifExpression.Cons.String())
-	output.WriteString(" ")
+	output.WriteString("if (")
+	output.WriteString(ifExpression.Cond.String())
+	output.WriteString(") ")
 	output.WriteString(ifExpression.Cons.String())
-	output.WriteString(" ")
-	output.WriteString(ifExpression.Alt.String())
+	if ifExpression.Alt != nil {
+		output.WriteString(" else ")
+		output.WriteString(ifExpression.Alt.String())
+	}
 	return output.String()
 }
 
+// Parameter is a parameter of a function. Default is the value it gets when
+// a call leaves it out, and the Rest parameter, written ...name, can only be
+// the last one and gets the arguments left over as an array.
+type Parameter struct {
+	Name    *Identifier
+	Default Expression
+	Rest    bool
+}
+
+func (parameter *Parameter) String() string {
+	switch {
+	case parameter.Rest:
+		return "..." + parameter.Name.String()
+	case parameter.Default != nil:
+		return parameter.Name.String() + " = " + parameter.Default.String()
+	}
+	return parameter.Name.String()
+}
+
 type FunctionLiteral struct {
 	Token      token.Token
-	Parameters []*Identifier
+	Name       string // name of the let binding, empty for anonymous functions
+	Parameters []*Parameter
 	Body       *BlockStatement
 }
 
 func (functionLiteral *FunctionLiteral) expressionNode()      {}
+func (functionLiteral *FunctionLiteral) Pos() token.Position  { return functionLiteral.Token.Pos }
 func (functionLiteral *FunctionLiteral) TokenLiteral() string { return functionLiteral.Token.Literal }
 func (functionLiteral *FunctionLiteral) String() string {
 	var output bytes.Buffer
@@ -239,15 +300,24 @@ type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	// Names are the names of the last len(Names) arguments, which were
+	// passed as name = value.
+	Names []*Identifier
 }
 
 func (callExpression *CallExpression) expressionNode()      {}
+func (callExpression *CallExpression) Pos() token.Position  { return callExpression.Function.Pos() }
 func (callExpression *CallExpression) TokenLiteral() string { return callExpression.Token.Literal }
 func (callExpression *CallExpression) String() string {
 	var out bytes.Buffer
 	var args []string
-	for _, a := range callExpression.Arguments {
-		args = append(args, a.String())
+	positional := len(callExpression.Arguments) - len(callExpression.Names)
+	for i, a := range callExpression.Arguments {
+		if i < positional {
+			args = append(args, a.String())
+		} else {
+			args = append(args, callExpression.Names[i-positional].String()+" = "+a.String())
+		}
 	}
 	out.WriteString(callExpression.Function.String())
 	out.WriteString("(")
@@ -262,6 +332,7 @@ type StringLiteral struct {
 }
 
 func (stringLiteral *StringLiteral) expressionNode()      {}
+func (stringLiteral *StringLiteral) Pos() token.Position  { return stringLiteral.Token.Pos }
 func (stringLiteral *StringLiteral) TokenLiteral() string { return stringLiteral.Token.Literal }
 func (stringLiteral *StringLiteral) String() string       { return stringLiteral.Token.Literal }
 
@@ -271,6 +342,7 @@ type ArrayLiteral struct {
 }
 
 func (arrayLiteral *ArrayLiteral) expressionNode()      {}
+func (arrayLiteral *ArrayLiteral) Pos() token.Position  { return arrayLiteral.Token.Pos }
 func (arrayLiteral *ArrayLiteral) TokenLiteral() string { return arrayLiteral.Token.Literal }
 func (arrayLiteral *ArrayLiteral) String() string {
 	var output bytes.Buffer
@@ -291,6 +363,7 @@ type IndexExpression struct {
 }
 
 func (indexExpression *IndexExpression) expressionNode()      {}
+func (indexExpression *IndexExpression) Pos() token.Position  { return indexExpression.Token.Pos }
 func (indexExpression *IndexExpression) TokenLiteral() string { return indexExpression.Token.Literal }
 func (indexExpression *IndexExpression) String() string {
 	var out bytes.Buffer
@@ -302,18 +375,51 @@ func (indexExpression *IndexExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression is `left[start:end]`, where start and end may be left out.
+type SliceExpression struct {
+	Token token.Token
+	Left  Expression
+	Start Expression
+	End   Expression
+}
+
+func (sliceExpression *SliceExpression) expressionNode()      {}
+func (sliceExpression *SliceExpression) Pos() token.Position  { return sliceExpression.Token.Pos }
+func (sliceExpression *SliceExpression) TokenLiteral() string { return sliceExpression.Token.Literal }
+func (sliceExpression *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(sliceExpression.Left.String())
+	out.WriteString("[")
+	if sliceExpression.Start != nil {
+		out.WriteString(sliceExpression.Start.String())
+	}
+	out.WriteString(":")
+	if sliceExpression.End != nil {
+		out.WriteString(sliceExpression.End.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
+
 type MapLiteral struct {
 	Token token.Token
-	Pairs map[Expression]Expression
+	Pairs []MapPair // in the order they are written
+}
+
+type MapPair struct {
+	Key   Expression
+	Value Expression
 }
 
 func (mapLiteral *MapLiteral) expressionNode()      {}
+func (mapLiteral *MapLiteral) Pos() token.Position  { return mapLiteral.Token.Pos }
 func (mapLiteral *MapLiteral) TokenLiteral() string { return mapLiteral.Token.Literal }
 func (mapLiteral *MapLiteral) String() string {
 	var out bytes.Buffer
 	var pairs []string
-	for key, value := range mapLiteral.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, pair := range mapLiteral.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -331,6 +437,7 @@ type ForStatement struct {
 }
 
 func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
 func (fs *ForStatement) TokenLiteral() string { return "for" }
 func (fs *ForStatement) String() string {
 	var out bytes.Buffer
@@ -340,7 +447,9 @@ func (fs *ForStatement) String() string {
 		out.WriteString(fs.Initializer.String())
 	}
 	out.WriteString("; ")
-	out.WriteString(fs.Condition.String())
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
 	out.WriteString("; ")
 	if fs.Post != nil {
 		out.WriteString(fs.Post.String())
@@ -350,3 +459,158 @@ func (fs *ForStatement) String() string {
 
 	return out.String()
 }
+
+type WhileStatement struct {
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while (")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(") ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string       { return bs.Token.Literal + ";" }
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return cs.Token.Literal + ";" }
+
+// ForInStatement is for (value in iterable) or for (key, value in iterable).
+type ForInStatement struct {
+	Token    token.Token
+	Key      *Identifier // nil when only one variable is given
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode()       {}
+func (fs *ForInStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+// ImportStatement is import "path/to/lib.sg" or import lib. Name is what
+// the module is bound to, the file name without its extension.
+type ImportStatement struct {
+	Token token.Token
+	Path  string
+	Name  *Identifier
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) Pos() token.Position  { return is.Token.Pos }
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	return "import " + strconv.Quote(is.Path) + ";"
+}
+
+// ExportStatement is a let statement at the top level of a file whose
+// variable other files can use after importing it.
+type ExportStatement struct {
+	Token token.Token
+	Let   *LetStatement
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) Pos() token.Position  { return es.Token.Pos }
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string {
+	return "export " + es.Let.String()
+}
+
+// MemberExpression is module.name.
+type MemberExpression struct {
+	Token token.Token // the . token
+	Left  Expression
+	Name  *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) Pos() token.Position  { return me.Token.Pos }
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	return "(" + me.Left.String() + "." + me.Name.String() + ")"
+}
+
+// TryStatement is try { } catch (e) { } finally { }. Either Catch or Finally
+// may be missing, and so may Param.
+type TryStatement struct {
+	Token   token.Token
+	Body    *BlockStatement
+	Param   *Identifier
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (ts *TryStatement) statementNode()       {}
+func (ts *TryStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *TryStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TryStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(ts.Body.String())
+	if ts.Catch != nil {
+		out.WriteString(" catch ")
+		if ts.Param != nil {
+			out.WriteString("(" + ts.Param.String() + ") ")
+		}
+		out.WriteString(ts.Catch.String())
+	}
+	if ts.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(ts.Finally.String())
+	}
+
+	return out.String()
+}
+
+type ThrowStatement struct {
+	Token token.Token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	return "throw " + ts.Value.String() + ";"
+}
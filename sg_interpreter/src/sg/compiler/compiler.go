@@ -0,0 +1,965 @@
+package compiler
+
+import (
+	"fmt"
+	"sg_interpreter/src/sg/Item"
+	"sg_interpreter/src/sg/ast"
+	"sg_interpreter/src/sg/code"
+	"sg_interpreter/src/sg/evaluator"
+	"sg_interpreter/src/sg/token"
+)
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+type CompilationScope struct {
+	instructions        code.Instructions
+	positions           code.PositionTable
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	loops               []*loopContext
+	tries               []*tryContext
+}
+
+// loopContext collects the jumps of break and continue statements, which are
+// patched once the loop they leave has been compiled.
+type loopContext struct {
+	breakJumps    []int
+	continueJumps []int
+}
+
+// tryContext is a try statement whose handler is active in the code being
+// compiled. Jumping out of it with break, continue or return has to end the
+// handler and run the finally block first.
+type tryContext struct {
+	loops   int // the number of loops the try statement is inside of
+	finally *ast.BlockStatement
+}
+
+type Compiler struct {
+	constants   []Item.Item
+	builtins    map[string]int
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	pos token.Position // position of the node being compiled
+	err error          // set when an operand did not fit in its instruction
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Positions    code.PositionTable
+	Constants    []Item.Item
+	NumLocals    int
+	GlobalNames  []string
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{Position: -1},
+		previousInstruction: EmittedInstruction{Position: -1},
+	}
+	return &Compiler{
+		constants:   []Item.Item{},
+		builtins:    make(map[string]int),
+		symbolTable: NewSymbolTable(),
+		scopes:      []CompilationScope{mainScope},
+	}
+}
+
+// NewModule returns a compiler for a file the program imports. The globals of
+// the file are its own, its constants are added to constants, those of the
+// program, which the vm keeps in one table.
+func NewModule(constants []Item.Item) *Compiler {
+	c := New()
+	c.constants = constants
+	return c
+}
+
+// CompileModule compiles the program of an imported file into code that the
+// vm runs like a function, which returns once the file has run.
+func (c *Compiler) CompileModule(program *ast.Program) error {
+	if err := c.Compile(program); err != nil {
+		return err
+	}
+	c.emit(code.OpReturn)
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Positions:    c.scopes[c.scopeIndex].positions,
+		Constants:    c.constants,
+		NumLocals:    c.symbolTable.frame.numLocals,
+		GlobalNames:  c.symbolTable.frame.globalNames,
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	outerPos := c.pos
+	if pos := node.Pos(); pos.IsValid() {
+		c.pos = pos
+	}
+	err := c.compileNode(node)
+	if err == nil {
+		err = c.err
+	}
+	c.pos = outerPos
+	return err
+}
+
+func (c *Compiler) compileNode(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		if err := c.compileStatements(node.Statements); err != nil {
+			return err
+		}
+		if !endsWithValue(node.Statements) {
+			// the result of the program is null, not whatever was popped last
+			c.emit(code.OpNull)
+			c.emit(code.OpPop)
+		}
+	case *ast.BlockStatement:
+		// every block is a scope of its own, its names go away when it ends
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		err := c.compileStatements(node.Statements)
+		c.symbolTable = c.symbolTable.Outer
+		return err
+	case *ast.ExpressionStatement:
+		if node.Expr == nil {
+			return nil
+		}
+		if err := c.Compile(node.Expr); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.LetStatement:
+		return c.compileLetStatement(node)
+	case *ast.ExportStatement:
+		return c.compileLetStatement(node.Let)
+	case *ast.ImportStatement:
+		// the vm compiles the module when the import runs
+		if c.symbolTable.IsDefined(node.Name.Value) {
+			c.raise("Variable %s already is defined in this function's scope!", node.Name.Value)
+			return nil
+		}
+		c.emit(code.OpImport, c.addConstant(&Item.String{Value: node.Path}))
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpDefineGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpDefineLocal, symbol.Index)
+		}
+	case *ast.SetStatement:
+		if target, ok := node.Target.(*ast.IndexExpression); ok {
+			return c.compileIndexAssignment(node, target)
+		}
+		if err := c.Compile(node.Val); err != nil {
+			return err
+		}
+		name := node.Target.(*ast.Identifier).Value
+		symbol, ok := c.symbolTable.Resolve(name)
+		if !ok {
+			symbol = c.symbolTable.DeclareGlobal(name)
+		}
+		c.storeSymbol(symbol)
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.RetValue); err != nil {
+			return err
+		}
+		if len(c.scopes[c.scopeIndex].tries) > 0 {
+			// the value waits in a variable, a finally block may break out
+			// of a loop and must not leave it on the stack
+			c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+			value := c.symbolTable.Define("<return>")
+			c.emit(code.OpDefineLocal, value.Index)
+			if err := c.leaveTries(0); err != nil {
+				return err
+			}
+			c.emit(code.OpGetLocal, value.Index)
+			c.symbolTable = c.symbolTable.Outer
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.TryStatement:
+		return c.compileTryStatement(node)
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+	case *ast.ForInStatement:
+		return c.compileForInStatement(node)
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		loops := c.scopes[c.scopeIndex].loops
+		if len(loops) == 0 {
+			// like in the evaluator, finally blocks run and catch blocks
+			// don't, the error is raised where the function or program ends
+			if err := c.leaveTries(0); err != nil {
+				return err
+			}
+			c.raise("%s outside loop", node.TokenLiteral())
+			return nil
+		}
+		loop := loops[len(loops)-1]
+		if err := c.leaveTries(len(loops)); err != nil {
+			return err
+		}
+		jumpPos := c.emit(code.OpJump, 9999)
+		if _, ok := node.(*ast.BreakStatement); ok {
+			loop.breakJumps = append(loop.breakJumps, jumpPos)
+		} else {
+			loop.continueJumps = append(loop.continueJumps, jumpPos)
+		}
+	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			c.emit(code.OpConstant, c.addConstant(&Item.BigInt{Value: node.Big}))
+		} else {
+			c.emit(code.OpConstant, c.addConstant(&Item.Integer{Value: node.Value}))
+		}
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&Item.Float{Value: node.Value}))
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&Item.String{Value: node.Value}))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		case "~":
+			c.emit(code.OpBitNot)
+		default:
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		op, ok := infixOpcodes[node.Operator]
+		if !ok {
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+		c.emit(op)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.Identifier:
+		c.loadIdentifier(node.Value)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		if len(node.Names) == 0 {
+			c.emit(code.OpCall, len(node.Arguments))
+			break
+		}
+		names := make([]Item.Item, len(node.Names))
+		for i, name := range node.Names {
+			names[i] = &Item.String{Value: name.Value}
+		}
+		namesIndex := c.addConstant(&Item.Array{Elements: names, Len: int64(len(names)), Capacity: int64(len(names))})
+		c.emit(code.OpCallNamed, len(node.Arguments), namesIndex)
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			if err := c.Compile(e); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.MapLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.SliceExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		// a bound that is left out is null
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				c.emit(code.OpNull)
+			} else if err := c.Compile(bound); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
+	case *ast.MemberExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		c.emit(code.OpMember, c.addConstant(&Item.String{Value: node.Name.Value}))
+	default:
+		return c.errorf("cannot compile %T", node)
+	}
+	return nil
+}
+
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+	">=": code.OpGreaterEqual,
+	"<=": code.OpLessEqual,
+	"%":  code.OpMod,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+}
+
+// compileLogicalExpression jumps over the right side of && and || when the
+// left side decides the result. The right side's value is turned into a
+// boolean with two OpBangs.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if node.Operator == "||" {
+		c.emit(code.OpTrue)
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(code.OpBang)
+		c.emit(code.OpBang)
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+		return nil
+	}
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	c.emit(code.OpFalse)
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+func (c *Compiler) compileStatements(statements []ast.Statement) error {
+	for _, s := range statements {
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endsWithValue reports whether statements end with an expression statement,
+// whose value is the value of them all, as in the evaluator. Any other
+// statement, like a loop or a let, leaves them without a value.
+func endsWithValue(statements []ast.Statement) bool {
+	if len(statements) == 0 {
+		return false
+	}
+	last, ok := statements[len(statements)-1].(*ast.ExpressionStatement)
+	return ok && last.Expr != nil
+}
+
+// compileIndexAssignment leaves the array or hash, the index and the value
+// for OpSetIndex. For `a[i] op= v`, a and i wait in variables so that they
+// are evaluated only once.
+func (c *Compiler) compileIndexAssignment(node *ast.SetStatement, target *ast.IndexExpression) error {
+	if node.Operator == "" {
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Val); err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex)
+		return nil
+	}
+	op, ok := infixOpcodes[node.Operator]
+	if !ok {
+		return c.errorf("unknown operator %s", node.Operator)
+	}
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	defer func() { c.symbolTable = c.symbolTable.Outer }()
+	left := c.symbolTable.Define("<left>")
+	if err := c.Compile(target.Left); err != nil {
+		return err
+	}
+	c.emit(code.OpDefineLocal, left.Index)
+	index := c.symbolTable.Define("<index>")
+	if err := c.Compile(target.Index); err != nil {
+		return err
+	}
+	c.emit(code.OpDefineLocal, index.Index)
+
+	c.emit(code.OpGetLocal, left.Index)
+	c.emit(code.OpGetLocal, index.Index)
+	c.emit(code.OpGetLocal, left.Index)
+	c.emit(code.OpGetLocal, index.Index)
+	c.emit(code.OpIndex)
+	if err := c.Compile(node.Val); err != nil {
+		return err
+	}
+	c.emit(op)
+	c.emit(code.OpSetIndex)
+	return nil
+}
+
+func (c *Compiler) compileLetStatement(node *ast.LetStatement) error {
+	if c.symbolTable.IsDefined(node.Id.Value) {
+		// the value is computed before the evaluator finds the mistake
+		if err := c.Compile(node.Val); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+		c.raise("Variable %s already is defined in this function's scope!", node.Id.Value)
+		return nil
+	}
+	if _, ok := node.Val.(*ast.FunctionLiteral); ok {
+		// Define the name first so the function can refer to itself.
+		symbol := c.symbolTable.Define(node.Id.Value)
+		if symbol.Scope == LocalScope {
+			c.emit(code.OpNull)
+			c.emit(code.OpDefineLocal, symbol.Index)
+		}
+		if err := c.Compile(node.Val); err != nil {
+			return err
+		}
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpDefineGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+		return nil
+	}
+	if err := c.Compile(node.Val); err != nil {
+		return err
+	}
+	symbol := c.symbolTable.Define(node.Id.Value)
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpDefineGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpDefineLocal, symbol.Index)
+	}
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Cond); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.compileBlockValue(node.Cons); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alt == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.Alt); err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileBlockValue compiles a block that is used as an expression, leaving
+// the value of its last expression statement (or null) on the stack.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+	if endsWithValue(block.Statements) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	// the initializer's variables belong to the loop, not to the enclosing block
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	defer func() { c.symbolTable = c.symbolTable.Outer }()
+	if node.Initializer != nil {
+		if err := c.Compile(node.Initializer); err != nil {
+			return err
+		}
+	}
+	conditionPos := len(c.currentInstructions())
+
+	jumpNotTruthyPos := -1
+	if node.Condition != nil {
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthyPos = c.emit(code.OpJumpNotTruthy, 9999)
+	}
+	loop := c.enterLoop()
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.leaveLoop()
+
+	postPos := len(c.currentInstructions())
+	if node.Post != nil {
+		if err := c.Compile(node.Post); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpJump, conditionPos)
+
+	afterLoopPos := len(c.currentInstructions())
+	if jumpNotTruthyPos >= 0 {
+		c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+	}
+	c.patchLoopJumps(loop, postPos, afterLoopPos)
+	return nil
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	conditionPos := len(c.currentInstructions())
+
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	loop := c.enterLoop()
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.leaveLoop()
+	c.emit(code.OpJump, conditionPos)
+
+	afterLoopPos := len(c.currentInstructions())
+	c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+	c.patchLoopJumps(loop, conditionPos, afterLoopPos)
+	return nil
+}
+
+// compileForInStatement keeps the iterator on the stack while the loop runs.
+// OpIterNext pushes the next key and value (or only the value) or jumps to
+// the OpPop that discards the iterator once it is exhausted.
+func (c *Compiler) compileForInStatement(node *ast.ForInStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	numVariables := 1
+	if node.Key != nil {
+		numVariables = 2
+	}
+	loopStartPos := c.emit(code.OpIterNext, 9999, numVariables)
+	value := c.symbolTable.Define(node.Value.Value)
+	c.emit(code.OpDefineLocal, value.Index)
+	if node.Key != nil {
+		key := c.symbolTable.Define(node.Key.Value)
+		c.emit(code.OpDefineLocal, key.Index)
+	}
+
+	loop := c.enterLoop()
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.leaveLoop()
+	c.symbolTable = c.symbolTable.Outer
+	c.emit(code.OpJump, loopStartPos)
+
+	afterLoopPos := len(c.currentInstructions())
+	c.emit(code.OpPop)
+	c.replaceInstruction(loopStartPos, c.makeInstruction(code.OpIterNext, afterLoopPos, numVariables))
+	c.patchLoopJumps(loop, loopStartPos, afterLoopPos)
+	return nil
+}
+
+func (c *Compiler) enterLoop() *loopContext {
+	loop := &loopContext{}
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, loop)
+	return loop
+}
+
+func (c *Compiler) leaveLoop() {
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+}
+
+func (c *Compiler) patchLoopJumps(loop *loopContext, continuePos int, breakPos int) {
+	for _, pos := range loop.continueJumps {
+		c.changeOperand(pos, continuePos)
+	}
+	for _, pos := range loop.breakJumps {
+		c.changeOperand(pos, breakPos)
+	}
+}
+
+// compileTryStatement lays out a try statement as
+//
+//	OpTry catch; body; OpEndTry; finally; OpJump end
+//	catch: define e; OpTry rethrow; catch block; OpEndTry; finally; OpJump end
+//	rethrow: finally; OpThrow
+//	end:
+//
+// leaving out the parts for a missing catch or finally block.
+func (c *Compiler) compileTryStatement(node *ast.TryStatement) error {
+	tryPos := c.emit(code.OpTry, 9999)
+	c.enterTry(node.Finally)
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.leaveTry()
+	c.emit(code.OpEndTry)
+	if err := c.compileFinally(node.Finally); err != nil {
+		return err
+	}
+	endJumps := []int{c.emit(code.OpJump, 9999)}
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+
+	if node.Catch != nil {
+		// like a function body, the catch block shares its scope with e
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		if node.Param != nil {
+			param := c.symbolTable.Define(node.Param.Value)
+			c.emit(code.OpDefineLocal, param.Index)
+		} else {
+			c.emit(code.OpPop)
+		}
+		rethrowPos := -1
+		if node.Finally != nil {
+			rethrowPos = c.emit(code.OpTry, 9999)
+			c.enterTry(node.Finally)
+		}
+		if err := c.compileStatements(node.Catch.Statements); err != nil {
+			return err
+		}
+		if node.Finally != nil {
+			c.leaveTry()
+			c.emit(code.OpEndTry)
+			if err := c.compileFinally(node.Finally); err != nil {
+				return err
+			}
+		}
+		c.symbolTable = c.symbolTable.Outer
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+		if rethrowPos >= 0 {
+			c.changeOperand(rethrowPos, len(c.currentInstructions()))
+		}
+	}
+
+	if node.Finally != nil {
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		// the error waits in a variable while the finally block runs
+		raised := c.symbolTable.Define("<error>")
+		c.emit(code.OpDefineLocal, raised.Index)
+		if err := c.compileFinally(node.Finally); err != nil {
+			return err
+		}
+		c.emit(code.OpGetLocal, raised.Index)
+		c.emit(code.OpThrow)
+		c.symbolTable = c.symbolTable.Outer
+	}
+	for _, pos := range endJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+func (c *Compiler) compileFinally(finally *ast.BlockStatement) error {
+	if finally == nil {
+		return nil
+	}
+	return c.Compile(finally)
+}
+
+func (c *Compiler) enterTry(finally *ast.BlockStatement) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, &tryContext{loops: len(scope.loops), finally: finally})
+}
+
+func (c *Compiler) leaveTry() {
+	tries := c.scopes[c.scopeIndex].tries
+	c.scopes[c.scopeIndex].tries = tries[:len(tries)-1]
+}
+
+// leaveTries ends the handlers of the try statements inside the innermost
+// loops loops, innermost first, and runs their finally blocks. While a
+// finally block is compiled only the try statements around it are active.
+func (c *Compiler) leaveTries(loops int) error {
+	tries := c.scopes[c.scopeIndex].tries
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+	for i := len(tries) - 1; i >= 0 && tries[i].loops >= loops; i-- {
+		c.emit(code.OpEndTry)
+		c.scopes[c.scopeIndex].tries = tries[:i]
+		if err := c.compileFinally(tries[i].finally); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+	// the parameters take the first locals, and like in the evaluator a
+	// default value is computed when the call leaves the parameter out,
+	// seeing only the parameters before it
+	c.symbolTable.numLocals = len(node.Parameters)
+	for i, p := range node.Parameters {
+		if p.Default != nil {
+			skipPos := c.emit(code.OpSkipDefault, i, 9999)
+			if err := c.Compile(p.Default); err != nil {
+				return err
+			}
+			c.emit(code.OpSetLocal, i)
+			c.replaceInstruction(skipPos, c.makeInstruction(code.OpSkipDefault, i, len(c.currentInstructions())))
+		}
+		c.symbolTable.DefineParameter(p.Name.Value, i)
+	}
+	// the body shares its scope with the parameters
+	if err := c.compileStatements(node.Body.Statements); err != nil {
+		return err
+	}
+	if endsWithValue(node.Body.Statements) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numLocals
+	positions := c.scopes[c.scopeIndex].positions
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		if s.Scope == LocalScope {
+			c.emit(code.OpLocalCell, s.Index)
+		} else {
+			c.emit(code.OpFreeCell, s.Index)
+		}
+	}
+
+	compiledFn := &Item.CompiledFunction{
+		Name:          node.Name,
+		Instructions:  instructions,
+		Positions:     positions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Parameters:    node.Parameters,
+		Body:          node.Body,
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+	return nil
+}
+
+func (c *Compiler) loadIdentifier(name string) {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok {
+		if builtin, isBuiltin := evaluator.LookupBuiltin(name); isBuiltin {
+			idx, cached := c.builtins[name]
+			if !cached {
+				idx = c.addConstant(builtin)
+				c.builtins[name] = idx
+			}
+			c.emit(code.OpConstant, idx)
+			return
+		}
+		symbol = c.symbolTable.DeclareGlobal(name)
+	}
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, symbol.Index)
+	}
+}
+
+func (c *Compiler) storeSymbol(symbol Symbol) {
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, symbol.Index)
+	}
+}
+
+func (c *Compiler) addConstant(item Item.Item) int {
+	c.constants = append(c.constants, item)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := c.makeInstruction(op, operands...)
+	pos := c.addInstruction(ins)
+	c.setLastInstruction(op, pos)
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+
+	positions := c.scopes[c.scopeIndex].positions
+	if len(positions) == 0 || positions[len(positions)-1].Pos != c.pos {
+		c.scopes[c.scopeIndex].positions = append(positions, code.PositionEntry{Offset: posNewInstruction, Pos: c.pos})
+	}
+	return posNewInstruction
+}
+
+// makeInstruction is code.Make for operands that may be too large for their
+// width, like a jump past 64KB of bytecode. Those are reported as an error
+// instead of being truncated.
+func (c *Compiler) makeInstruction(op code.Opcode, operands ...int) []byte {
+	def, _ := code.Lookup(byte(op))
+	for i, operand := range operands {
+		limit := 1 << (8 * def.OperandWidths[i])
+		if (operand < 0 || operand >= limit) && c.err == nil {
+			c.err = c.errorf("program is too large for the vm: %s needs the operand %d, the limit is %d", def.Name, operand, limit-1)
+		}
+	}
+	return code.Make(op, operands...)
+}
+
+func (c *Compiler) errorf(format string, a ...interface{}) error {
+	message := fmt.Sprintf(format, a...)
+	if c.pos.IsValid() {
+		message = c.pos.String() + ": " + message
+	}
+	return fmt.Errorf("%s", message)
+}
+
+// raise compiles a mistake that the evaluator only finds when it runs the
+// statement, such as defining a variable twice, into raising the error it
+// gives there, so that the program runs up to it on both backends.
+func (c *Compiler) raise(format string, a ...interface{}) {
+	c.emit(code.OpConstant, c.addConstant(&Item.ErrorValue{Message: fmt.Sprintf(format, a...)}))
+	c.emit(code.OpThrow)
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	return last.Position >= 0 && last.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	positions := c.scopes[c.scopeIndex].positions
+	for len(positions) > 0 && positions[len(positions)-1].Offset >= last.Position {
+		positions = positions[:len(positions)-1]
+	}
+	c.scopes[c.scopeIndex].positions = positions
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := c.makeInstruction(op, operand)
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{Position: -1},
+		previousInstruction: EmittedInstruction{Position: -1},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
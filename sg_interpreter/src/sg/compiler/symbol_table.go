@@ -0,0 +1,130 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+	FreeScope   SymbolScope = "FREE"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable resolves names to storage slots. The outermost table holds the
+// globals, every function gets an enclosed table with its own locals, and
+// block tables only add names while allocating their slots in the frame of
+// the function (or program) they belong to.
+type SymbolTable struct {
+	Outer       *SymbolTable
+	FreeSymbols []Symbol
+
+	store   map[string]Symbol
+	defined map[string]bool
+	frame   *SymbolTable
+	block   bool
+
+	numLocals   int
+	globalNames []string
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := &SymbolTable{
+		store:   make(map[string]Symbol),
+		defined: make(map[string]bool),
+	}
+	s.frame = s
+	return s
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	s.frame = outer.frame
+	s.block = true
+	return s
+}
+
+func (s *SymbolTable) isGlobal() bool {
+	return s.Outer == nil
+}
+
+func (s *SymbolTable) Define(name string) Symbol {
+	s.defined[name] = true
+	if s.isGlobal() {
+		if symbol, ok := s.store[name]; ok {
+			// the name was referenced before its let, reuse the reserved slot
+			return symbol
+		}
+		symbol := Symbol{Name: name, Scope: GlobalScope, Index: len(s.globalNames)}
+		s.globalNames = append(s.globalNames, name)
+		s.store[name] = symbol
+		return symbol
+	}
+	symbol := Symbol{Name: name, Scope: LocalScope, Index: s.frame.numLocals}
+	s.frame.numLocals++
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineParameter defines the parameter of a function that takes the local
+// slot index, which the function reserved before.
+func (s *SymbolTable) DefineParameter(name string, index int) Symbol {
+	s.defined[name] = true
+	symbol := Symbol{Name: name, Scope: LocalScope, Index: index}
+	s.store[name] = symbol
+	return symbol
+}
+
+// IsDefined reports whether name was declared with let in this very table.
+func (s *SymbolTable) IsDefined(name string) bool {
+	return s.defined[name]
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok {
+		return symbol, true
+	}
+	if s.Outer == nil {
+		return symbol, false
+	}
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || s.block || symbol.Scope == GlobalScope {
+		return symbol, ok
+	}
+	return s.defineFree(symbol), true
+}
+
+// DeclareGlobal reserves a global slot for a name that is not defined yet.
+// Like the evaluator, the vm only reports it as missing if it is still
+// unset when the code referencing it runs.
+func (s *SymbolTable) DeclareGlobal(name string) Symbol {
+	global := s
+	for global.Outer != nil {
+		global = global.Outer
+	}
+	if symbol, ok := global.store[name]; ok {
+		return symbol
+	}
+	symbol := Symbol{Name: name, Scope: GlobalScope, Index: len(global.globalNames)}
+	global.globalNames = append(global.globalNames, name)
+	global.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.store[original.Name] = symbol
+	return symbol
+}
@@ -0,0 +1,211 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+	"sg_interpreter/src/sg/Item"
+)
+
+// CheckedArithmetic makes integer arithmetic report an error when a result
+// does not fit in 64 bits, instead of promoting it to a BigInt.
+var CheckedArithmetic = false
+
+// maxShift bounds the result of << on big integers, so a typo like
+// `1 << 1000000000000` fails instead of eating all the memory.
+const maxShift = 1 << 24
+
+func addInt(left, right int64) Item.Item {
+	if result := left + right; (result > left) == (right > 0) {
+		return &Item.Integer{Value: result}
+	}
+	return promote(left, "+", right)
+}
+
+func subInt(left, right int64) Item.Item {
+	if result := left - right; (result < left) == (right > 0) {
+		return &Item.Integer{Value: result}
+	}
+	return promote(left, "-", right)
+}
+
+func mulInt(left, right int64) Item.Item {
+	if result, ok := mulInt64(left, right); ok {
+		return &Item.Integer{Value: result}
+	}
+	return promote(left, "*", right)
+}
+
+// mulInt64 multiplies and reports whether the product fits in an int64.
+func mulInt64(left, right int64) (int64, bool) {
+	if left == 0 || right == 0 {
+		return 0, true
+	}
+	result := left * right
+	if result/right != left || left == -1 && right == math.MinInt64 || right == -1 && left == math.MinInt64 {
+		return 0, false
+	}
+	return result, true
+}
+
+// divInt also covers %. Both round towards zero, like Go does.
+func divInt(left int64, op string, right int64) Item.Item {
+	if right == 0 {
+		return divisionByZero(op)
+	}
+	if op == "%" {
+		return &Item.Integer{Value: left % right}
+	}
+	if left == math.MinInt64 && right == -1 {
+		return promote(left, op, right)
+	}
+	return &Item.Integer{Value: left / right}
+}
+
+func shlInt(left, right int64) Item.Item {
+	if right < 0 {
+		return newKindError(Item.VALUE_ERROR, "negative shift count: %d", right)
+	}
+	if right < 64 && left<<right>>right == left {
+		return &Item.Integer{Value: left << right}
+	}
+	return promote(left, "<<", right)
+}
+
+func negInt(value int64) Item.Item {
+	if value == math.MinInt64 {
+		if CheckedArithmetic {
+			return newKindError(Item.OVERFLOW_ERROR, "integer overflow: -(%d)", value)
+		}
+		return &Item.BigInt{Value: new(big.Int).Neg(big.NewInt(value))}
+	}
+	return &Item.Integer{Value: -value}
+}
+
+// promote redoes an int64 operation whose result overflowed on big integers.
+func promote(left int64, op string, right int64) Item.Item {
+	if CheckedArithmetic {
+		return newKindError(Item.OVERFLOW_ERROR, "integer overflow: %d %s %d", left, op, right)
+	}
+	return evalBigIntInfixExpr(big.NewInt(left), op, big.NewInt(right))
+}
+
+func divisionByZero(op string) *Item.Error {
+	if op == "%" {
+		return newKindError(Item.ZERO_DIVISION, "modulo by zero")
+	}
+	return newKindError(Item.ZERO_DIVISION, "division by zero")
+}
+
+// evalBigIntInfixExpr handles integer operations where at least one side is
+// a BigInt or where the int64 result overflowed. It returns nil for the
+// operators integers do not support.
+func evalBigIntInfixExpr(left *big.Int, op string, right *big.Int) Item.Item {
+	result := new(big.Int)
+	switch op {
+	case "+":
+		result.Add(left, right)
+	case "-":
+		result.Sub(left, right)
+	case "*":
+		result.Mul(left, right)
+	case "/", "%":
+		if right.Sign() == 0 {
+			return divisionByZero(op)
+		}
+		if op == "/" {
+			result.Quo(left, right)
+		} else {
+			result.Rem(left, right)
+		}
+	case "&":
+		result.And(left, right)
+	case "|":
+		result.Or(left, right)
+	case "^":
+		result.Xor(left, right)
+	case "<<", ">>":
+		if right.Sign() < 0 {
+			return newKindError(Item.VALUE_ERROR, "negative shift count: %s", right)
+		}
+		if op == ">>" {
+			// shifting out every bit leaves 0, or -1 for negative numbers
+			shift := uint(left.BitLen() + 1)
+			if right.IsInt64() && right.Int64() < int64(shift) {
+				shift = uint(right.Int64())
+			}
+			result.Rsh(left, shift)
+		} else if left.Sign() == 0 {
+			return &Item.Integer{Value: 0}
+		} else if !right.IsInt64() || right.Int64() > maxShift || int64(left.BitLen())+right.Int64() > maxShift {
+			return newKindError(Item.OVERFLOW_ERROR, "shift count too large: %s", right)
+		} else {
+			result.Lsh(left, uint(right.Int64()))
+		}
+	case "==":
+		return boolToBoolean(left.Cmp(right) == 0)
+	case "!=":
+		return boolToBoolean(left.Cmp(right) != 0)
+	case "<":
+		return boolToBoolean(left.Cmp(right) < 0)
+	case ">":
+		return boolToBoolean(left.Cmp(right) > 0)
+	case "<=":
+		return boolToBoolean(left.Cmp(right) <= 0)
+	case ">=":
+		return boolToBoolean(left.Cmp(right) >= 0)
+	default:
+		return nil
+	}
+	return normalizeBigInt(result)
+}
+
+// normalizeBigInt turns results that fit in 64 bits back into an Integer.
+func normalizeBigInt(value *big.Int) Item.Item {
+	if value.IsInt64() {
+		return &Item.Integer{Value: value.Int64()}
+	}
+	return &Item.BigInt{Value: value}
+}
+
+func isInteger(item Item.Item) bool {
+	return item.Type() == Item.INTEGER_ITEM || item.Type() == Item.BIGINT_ITEM
+}
+
+func toBigInt(item Item.Item) (*big.Int, bool) {
+	switch item := item.(type) {
+	case *Item.Integer:
+		return big.NewInt(item.Value), true
+	case *Item.BigInt:
+		return item.Value, true
+	}
+	return nil, false
+}
+
+// compareExact compares integers and floats without rounding the integer to
+// a float first. It reports false when a float is NaN.
+func compareExact(left, right Item.Item) (int, bool) {
+	l, ok := toBigFloat(left)
+	if !ok {
+		return 0, false
+	}
+	r, ok := toBigFloat(right)
+	if !ok {
+		return 0, false
+	}
+	return l.Cmp(r), true
+}
+
+func toBigFloat(item Item.Item) (*big.Float, bool) {
+	switch item := item.(type) {
+	case *Item.Integer:
+		return new(big.Float).SetInt64(item.Value), true
+	case *Item.BigInt:
+		return new(big.Float).SetInt(item.Value), true
+	case *Item.Float:
+		if math.IsNaN(item.Value) {
+			return nil, false
+		}
+		return new(big.Float).SetFloat64(item.Value), true
+	}
+	return nil, false
+}
@@ -0,0 +1,165 @@
+package evaluator
+
+import "sg_interpreter/src/sg/Item"
+
+// maxArrayLength bounds the arrays make builds, so a large count is an error
+// instead of running out of memory.
+const maxArrayLength = 1 << 28
+
+func init() {
+	for name, builtin := range arrayBuiltins {
+		builtins[name] = builtin
+	}
+}
+
+// arrayBuiltins either change the array they are given, pop, insert,
+// remove_at and fill, or leave it alone and return a new one, copy, concat
+// and make.
+var arrayBuiltins = map[string]*Item.Builtin{
+	"pop": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) != 1 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=1. Received=%d.", len(args))
+		}
+		arr, ok := args[0].(*Item.Array)
+		if !ok {
+			return newKindError(Item.TYPE_ERROR, "Argument to `pop` must be ARRAY. Received %s", args[0].Type())
+		}
+		if arr.Len == 0 {
+			return newKindError(Item.INDEX_ERROR, "`pop` from an empty array")
+		}
+		return removeAt(arr, arr.Len-1)
+	}},
+	"insert": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) != 3 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=3. Received=%d.", len(args))
+		}
+		arr, idx, err := arrayAndIndex("insert", args)
+		if err != nil {
+			return err
+		}
+		if idx < 0 || idx > arr.Len {
+			return newKindError(Item.INDEX_ERROR, "`insert` index %d out of range for array of length %d", idx, arr.Len)
+		}
+		if arr.Len == arr.Capacity {
+			arr.Capacity = 2*arr.Capacity + 1
+			elements := make([]Item.Item, arr.Capacity)
+			copy(elements, arr.Elements[:arr.Len])
+			arr.Elements = elements
+		}
+		copy(arr.Elements[idx+1:arr.Len+1], arr.Elements[idx:arr.Len])
+		arr.Elements[idx] = args[2]
+		arr.Len++
+		return arr
+	}},
+	"remove_at": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) != 2 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=2. Received=%d.", len(args))
+		}
+		arr, idx, err := arrayAndIndex("remove_at", args)
+		if err != nil {
+			return err
+		}
+		if idx < 0 || idx >= arr.Len {
+			return newKindError(Item.INDEX_ERROR, "`remove_at` index %d out of range for array of length %d", idx, arr.Len)
+		}
+		return removeAt(arr, idx)
+	}},
+	"fill": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) != 2 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=2. Received=%d.", len(args))
+		}
+		arr, ok := args[0].(*Item.Array)
+		if !ok {
+			return newKindError(Item.TYPE_ERROR, "First argument to `fill` must be ARRAY. Received %s", args[0].Type())
+		}
+		for i := range arr.Elements[:arr.Len] {
+			arr.Elements[i] = args[1]
+		}
+		return arr
+	}},
+	"copy": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) != 1 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=1. Received=%d.", len(args))
+		}
+		arr, ok := args[0].(*Item.Array)
+		if !ok {
+			return newKindError(Item.TYPE_ERROR, "Argument to `copy` must be ARRAY. Received %s", args[0].Type())
+		}
+		return concatArrays(arr)
+	}},
+	"concat": {Fn: func(args ...Item.Item) Item.Item {
+		arrays := make([]*Item.Array, len(args))
+		for i, arg := range args {
+			arr, ok := arg.(*Item.Array)
+			if !ok {
+				return newKindError(Item.TYPE_ERROR, "Arguments to `concat` must be ARRAY. Received %s", arg.Type())
+			}
+			arrays[i] = arr
+		}
+		return concatArrays(arrays...)
+	}},
+	"make": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) != 2 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=2. Received=%d.", len(args))
+		}
+		count, ok := args[0].(*Item.Integer)
+		if !ok {
+			return newKindError(Item.TYPE_ERROR, "First argument to `make` must be INTEGER. Received %s", args[0].Type())
+		}
+		if count.Value < 0 {
+			return newKindError(Item.VALUE_ERROR, "`make` needs a count of at least 0, got %d", count.Value)
+		}
+		if count.Value > maxArrayLength {
+			return newKindError(Item.VALUE_ERROR, "`make` would make an array longer than %d elements", maxArrayLength)
+		}
+		elements := make([]Item.Item, count.Value)
+		for i := range elements {
+			elements[i] = args[1]
+		}
+		return newArray(elements)
+	}},
+}
+
+func arrayAndIndex(name string, args []Item.Item) (*Item.Array, int64, *Item.Error) {
+	arr, ok := args[0].(*Item.Array)
+	if !ok {
+		return nil, 0, newKindError(Item.TYPE_ERROR, "First argument to `%s` must be ARRAY. Received %s", name, args[0].Type())
+	}
+	idx, ok := args[1].(*Item.Integer)
+	if !ok {
+		return nil, 0, newKindError(Item.TYPE_ERROR, "Second argument to `%s` must be INTEGER. Received %s", name, args[1].Type())
+	}
+	return arr, idx.Value, nil
+}
+
+// removeAt takes the element at idx out of arr and returns it.
+func removeAt(arr *Item.Array, idx int64) Item.Item {
+	removed := arr.Elements[idx]
+	copy(arr.Elements[idx:arr.Len-1], arr.Elements[idx+1:arr.Len])
+	arr.Len--
+	arr.Elements[arr.Len] = nil
+	return removed
+}
+
+func concatArrays(arrays ...*Item.Array) *Item.Array {
+	elements := []Item.Item{}
+	for _, arr := range arrays {
+		elements = append(elements, arr.Elements[:arr.Len]...)
+	}
+	return newArray(elements)
+}
+
+// arrayIndex returns the position of the first element of arr equal to
+// value, or -1.
+func arrayIndex(arr *Item.Array, value Item.Item) (int64, *Item.Error) {
+	for i, element := range arr.Elements[:arr.Len] {
+		same, err := equal(element, value)
+		if err != nil {
+			return 0, err
+		}
+		if same {
+			return int64(i), nil
+		}
+	}
+	return -1, nil
+}
@@ -2,15 +2,21 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
+	"math"
+	"math/big"
 	"math/rand"
+	"os"
 	"sg_interpreter/src/sg/Item"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var builtins = map[string]*Item.Builtin{
 	"len": {Fn: func(args ...Item.Item) Item.Item {
 		if len(args) != 1 {
-			return newError("Wrong number of arguments! Expected = 1. Received=%d",
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected = 1. Received=%d",
 				len(args))
 		}
 		switch arg := args[0].(type) {
@@ -18,40 +24,224 @@ var builtins = map[string]*Item.Builtin{
 			return &Item.Integer{Value: arg.Len}
 		case *Item.String:
 			return &Item.Integer{Value: int64(len(arg.Value))}
+		case *Item.Range:
+			return &Item.Integer{Value: arg.Len()}
+		case *Item.Hash:
+			return &Item.Integer{Value: int64(arg.Len())}
 		default:
-			return newError("Argument `len` not supported. Received %s",
+			return newKindError(Item.TYPE_ERROR, "Argument `len` not supported. Received %s",
 				args[0].Type())
 		}
 	},
 	},
-	"puts": {
+	"range": {
 		Fn: func(args ...Item.Item) Item.Item {
-			res := ""
-			first := true
-			for _, arg := range args {
-				if first == false {
-					res += " "
+			if len(args) < 1 || len(args) > 3 {
+				return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected 1 to 3. Received=%d.", len(args))
+			}
+			bounds := make([]int64, len(args))
+			for i, arg := range args {
+				integer, ok := arg.(*Item.Integer)
+				if !ok {
+					return newKindError(Item.TYPE_ERROR, "Arguments to `range` must be INTEGER. Received %s", arg.Type())
 				}
-				res += arg.Output()
-				first = false
+				bounds[i] = integer.Value
+			}
+			switch len(bounds) {
+			case 1:
+				return &Item.Range{Start: 0, Stop: bounds[0], Step: 1}
+			case 2:
+				return &Item.Range{Start: bounds[0], Stop: bounds[1], Step: 1}
+			}
+			if bounds[2] == 0 {
+				return newKindError(Item.VALUE_ERROR, "Step of `range` must not be zero!")
+			}
+			return &Item.Range{Start: bounds[0], Stop: bounds[1], Step: bounds[2]}
+		},
+	},
+	"int": {
+		Fn: func(args ...Item.Item) Item.Item {
+			if len(args) != 1 {
+				return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=1. Received=%d", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Item.Integer, *Item.BigInt:
+				return arg
+			case *Item.Float:
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return newKindError(Item.VALUE_ERROR, "Float %s can not be converted to an INTEGER", arg.Output())
+				}
+				// float64(math.MaxInt64) rounds up to 2^63, which is already out of range
+				if arg.Value < math.MinInt64 || arg.Value >= math.MaxInt64 {
+					value, _ := big.NewFloat(arg.Value).Int(nil)
+					return normalizeBigInt(value)
+				}
+				return &Item.Integer{Value: int64(arg.Value)}
+			case *Item.String:
+				text := strings.TrimSpace(arg.Value)
+				if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+					return &Item.Integer{Value: value}
+				}
+				value, ok := new(big.Int).SetString(text, 10)
+				if !ok {
+					return newKindError(Item.VALUE_ERROR, "Couldn't convert %q to an INTEGER", arg.Value)
+				}
+				return normalizeBigInt(value)
+			default:
+				return newKindError(Item.TYPE_ERROR, "Argument to `int` must be INTEGER, FLOAT or STRING. Received %s", arg.Type())
 			}
-			fmt.Println(res)
-			return NULL
 		},
 	},
+	"float": {
+		Fn: func(args ...Item.Item) Item.Item {
+			if len(args) != 1 {
+				return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=1. Received=%d", len(args))
+			}
+			if value, ok := toFloat(args[0]); ok {
+				return &Item.Float{Value: value}
+			}
+			str, ok := args[0].(*Item.String)
+			if !ok {
+				return newKindError(Item.TYPE_ERROR, "Argument to `float` must be INTEGER, FLOAT or STRING. Received %s", args[0].Type())
+			}
+			value, err := strconv.ParseFloat(strings.TrimSpace(str.Value), 64)
+			if err != nil {
+				return newKindError(Item.VALUE_ERROR, "Couldn't convert %q to a FLOAT", str.Value)
+			}
+			return &Item.Float{Value: value}
+		},
+	},
+	"sqrt":  floatBuiltin("sqrt", math.Sqrt),
+	"floor": floatBuiltin("floor", math.Floor),
+	"ceil":  floatBuiltin("ceil", math.Ceil),
+	"abs": {
+		Fn: func(args ...Item.Item) Item.Item {
+			if len(args) != 1 {
+				return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=1. Received=%d", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Item.Integer:
+				if arg.Value < 0 {
+					return negInt(arg.Value)
+				}
+				return arg
+			case *Item.BigInt:
+				return normalizeBigInt(new(big.Int).Abs(arg.Value))
+			case *Item.Float:
+				return &Item.Float{Value: math.Abs(arg.Value)}
+			default:
+				return newKindError(Item.TYPE_ERROR, "Argument to `abs` must be INTEGER or FLOAT. Received %s", arg.Type())
+			}
+		},
+	},
+	"pow": {
+		Fn: func(args ...Item.Item) Item.Item {
+			if len(args) != 2 {
+				return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=2. Received=%d.", len(args))
+			}
+			base, baseInt := args[0].(*Item.Integer)
+			exponent, exponentInt := args[1].(*Item.Integer)
+			if baseInt && exponentInt && exponent.Value >= 0 {
+				return intPow(base.Value, exponent.Value)
+			}
+			if isInteger(args[0]) && isInteger(args[1]) && !isNegative(args[1]) {
+				x, _ := toBigInt(args[0])
+				y, _ := toBigInt(args[1])
+				return bigPow(x, y)
+			}
+			x, ok := toFloat(args[0])
+			if !ok {
+				return newKindError(Item.TYPE_ERROR, "Arguments to `pow` must be INTEGER or FLOAT. Received %s", args[0].Type())
+			}
+			y, ok := toFloat(args[1])
+			if !ok {
+				return newKindError(Item.TYPE_ERROR, "Arguments to `pow` must be INTEGER or FLOAT. Received %s", args[1].Type())
+			}
+			return &Item.Float{Value: math.Pow(x, y)}
+		},
+	},
+	"powmod": {
+		Fn: func(args ...Item.Item) Item.Item {
+			if len(args) != 3 {
+				return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=3. Received=%d.", len(args))
+			}
+			values := make([]*big.Int, 3)
+			for i, arg := range args {
+				value, ok := toBigInt(arg)
+				if !ok {
+					return newKindError(Item.TYPE_ERROR, "Arguments to `powmod` must be INTEGER. Received %s", arg.Type())
+				}
+				values[i] = value
+			}
+			base, exponent, modulus := values[0], values[1], values[2]
+			if modulus.Sign() == 0 {
+				return newKindError(Item.ZERO_DIVISION, "modulo by zero")
+			}
+			m := new(big.Int).Abs(modulus)
+			if exponent.Sign() < 0 {
+				// a negative exponent raises the modular inverse instead
+				inverse := new(big.Int).ModInverse(new(big.Int).Mod(base, m), m)
+				if inverse == nil {
+					return newKindError(Item.VALUE_ERROR, "%s has no inverse modulo %s", base, modulus)
+				}
+				base, exponent = inverse, new(big.Int).Neg(exponent)
+			}
+			result := new(big.Int).Exp(base, exponent, m)
+			// like %, the result takes the sign of the modulus
+			if modulus.Sign() < 0 && result.Sign() != 0 {
+				result.Sub(result, m)
+			}
+			return normalizeBigInt(result)
+		},
+	},
+	"gcd": {
+		Fn: func(args ...Item.Item) Item.Item {
+			if len(args) != 2 {
+				return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=2. Received=%d.", len(args))
+			}
+			a, aInt := args[0].(*Item.Integer)
+			b, bInt := args[1].(*Item.Integer)
+			if aInt && bInt {
+				x, y := uint64(a.Value), uint64(b.Value)
+				if a.Value < 0 {
+					x = -x
+				}
+				if b.Value < 0 {
+					y = -y
+				}
+				for y != 0 {
+					x, y = y, x%y
+				}
+				if x <= math.MaxInt64 {
+					return &Item.Integer{Value: int64(x)}
+				}
+			}
+			x, ok := toBigInt(args[0])
+			if !ok {
+				return newKindError(Item.TYPE_ERROR, "Arguments to `gcd` must be INTEGER. Received %s", args[0].Type())
+			}
+			y, ok := toBigInt(args[1])
+			if !ok {
+				return newKindError(Item.TYPE_ERROR, "Arguments to `gcd` must be INTEGER. Received %s", args[1].Type())
+			}
+			return normalizeBigInt(new(big.Int).GCD(nil, nil, x, y))
+		},
+	},
+	"puts":  Printer(stdFile(func() *os.File { return os.Stdout })),
+	"eputs": Printer(stdFile(func() *os.File { return os.Stderr })),
 	"first": {
 		Fn: func(args ...Item.Item) Item.Item {
 			if len(args) != 1 {
-				return newError("Wrong number of arguments! Expected=1. Received=%d",
+				return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=1. Received=%d",
 					len(args))
 			}
 			if args[0].Type() != Item.ARRAY_ITEM {
-				return newError("Argument to `first` must be ARRAY. Received %s",
+				return newKindError(Item.TYPE_ERROR, "Argument to `first` must be ARRAY. Received %s",
 					args[0].Type())
 			}
 
 			arr := args[0].(*Item.Array)
-			if len(arr.Elements) > 0 {
+			if arr.Len > 0 {
 				return arr.Elements[0]
 			}
 
@@ -61,10 +251,10 @@ var builtins = map[string]*Item.Builtin{
 	"last": {
 		Fn: func(args ...Item.Item) Item.Item {
 			if len(args) != 1 {
-				return newError("Wrong number of arguments! Expected=1. Received=%d", len(args))
+				return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=1. Received=%d", len(args))
 			}
 			if args[0].Type() != Item.ARRAY_ITEM {
-				return newError("Argument to `last` must be ARRAY. Received %s", args[0].Type())
+				return newKindError(Item.TYPE_ERROR, "Argument to `last` must be ARRAY. Received %s", args[0].Type())
 			}
 			arr := args[0].(*Item.Array)
 			if arr.Len > 0 {
@@ -77,10 +267,10 @@ var builtins = map[string]*Item.Builtin{
 	"push": {
 		Fn: func(args ...Item.Item) Item.Item {
 			if len(args) != 2 {
-				return newError("Wrong number of arguments! Expected=2. Received=%d.", len(args))
+				return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=2. Received=%d.", len(args))
 			}
 			if args[0].Type() != Item.ARRAY_ITEM {
-				return newError("Argument to `push` must be ARRAY. Expected %s", args[0].Type())
+				return newKindError(Item.TYPE_ERROR, "Argument to `push` must be ARRAY. Expected %s", args[0].Type())
 			}
 			arr := args[0].(*Item.Array)
 			if arr.Len < arr.Capacity {
@@ -104,20 +294,20 @@ var builtins = map[string]*Item.Builtin{
 	"set": {
 		Fn: func(args ...Item.Item) Item.Item {
 			if len(args) != 3 {
-				return newError("Wrong number of arguments! Expected=3. Received=%d.", len(args))
+				return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=3. Received=%d.", len(args))
 			}
 			if args[0].Type() != Item.ARRAY_ITEM {
-				return newError("Argument to `set` must be ARRAY. Expected %s", args[0].Type())
+				return newKindError(Item.TYPE_ERROR, "Argument to `set` must be ARRAY. Expected %s", args[0].Type())
 			}
 			arr := args[0].(*Item.Array)
 			index, ok := args[1].(*Item.Integer)
 
 			if !ok {
-				return newError("Argument to `set` must be an INTEGER. Received %s", args[1].Type())
+				return newKindError(Item.TYPE_ERROR, "Argument to `set` must be an INTEGER. Received %s", args[1].Type())
 			}
 			idx := index.Value
 			if idx < 0 || idx >= arr.Len {
-				return newError("Index Argument is out of bounds!")
+				return newKindError(Item.INDEX_ERROR, "Index Argument is out of bounds!")
 			} else {
 				arr.Elements[idx] = args[2]
 			}
@@ -127,30 +317,76 @@ var builtins = map[string]*Item.Builtin{
 	"get": {
 		Fn: func(args ...Item.Item) Item.Item {
 			if len(args) != 2 {
-				return newError("Wrong number of arguments! Expected=2. Received=%d.", len(args))
+				return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=2. Received=%d.", len(args))
 			}
 			if args[0].Type() != Item.STRING_ITEM {
-				return newError("Argument to `get` must be STRING. Expected %s", args[0].Type())
+				return newKindError(Item.TYPE_ERROR, "Argument to `get` must be STRING. Expected %s", args[0].Type())
 			}
 			s := args[0].(*Item.String)
 			index, ok := args[1].(*Item.Integer)
 
 			if !ok {
-				return newError("Argument to `get` must be an INTEGER. Received %s", args[1].Type())
+				return newKindError(Item.TYPE_ERROR, "Argument to `get` must be an INTEGER. Received %s", args[1].Type())
 			}
 			idx := index.Value
 			if idx < 0 || idx >= int64(len(s.Value)) {
-				return newError("Index Argument is out of bounds!")
+				return newKindError(Item.INDEX_ERROR, "Index Argument is out of bounds!")
 			} else {
 				return &Item.String{Value: string(s.Value[idx])} // Correctly slicing the string
 			}
 		},
 	},
+	"keys":   hashBuiltin("keys", func(pair Item.HashPair) Item.Item { return pair.Key }),
+	"values": hashBuiltin("values", func(pair Item.HashPair) Item.Item { return pair.Value }),
+	"items": hashBuiltin("items", func(pair Item.HashPair) Item.Item {
+		return &Item.Array{Elements: []Item.Item{pair.Key, pair.Value}, Len: 2, Capacity: 2}
+	}),
+	"has": {
+		Fn: func(args ...Item.Item) Item.Item {
+			hash, key, err := hashAndKey("has", args)
+			if err != nil {
+				return err
+			}
+			_, ok := hash.Get(key)
+			return boolToBoolean(ok)
+		},
+	},
+	"delete": {
+		Fn: func(args ...Item.Item) Item.Item {
+			hash, key, err := hashAndKey("delete", args)
+			if err != nil {
+				return err
+			}
+			hash.Delete(key)
+			return hash
+		},
+	},
+	"merge": {
+		Fn: func(args ...Item.Item) Item.Item {
+			if len(args) < 2 {
+				return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected at least 2. Received=%d.", len(args))
+			}
+			merged := Item.NewHash()
+			for _, arg := range args {
+				hash, ok := arg.(*Item.Hash)
+				if !ok {
+					return newKindError(Item.TYPE_ERROR, "Arguments to `merge` must be HASH. Received %s", arg.Type())
+				}
+				for _, pair := range hash.Pairs() {
+					merged.Set(pair.Key.(Item.Hashable), pair.Value)
+				}
+			}
+			return merged
+		},
+	},
 	"shuffle": {Fn: func(args ...Item.Item) Item.Item {
 		if len(args) != 1 {
-			return newError("Wrong number of arguments! Expected = 1. Received=%d",
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected = 1. Received=%d",
 				len(args))
 		}
+		if args[0].Type() != Item.ARRAY_ITEM {
+			return newKindError(Item.TYPE_ERROR, "Argument to `shuffle` must be ARRAY. Received %s", args[0].Type())
+		}
 		arr := args[0].(*Item.Array)
 		rand.Seed(time.Now().UnixNano())
 		for i := arr.Len - 1; i > 0; i-- {
@@ -162,9 +398,12 @@ var builtins = map[string]*Item.Builtin{
 	},
 	"reverse": {Fn: func(args ...Item.Item) Item.Item {
 		if len(args) != 1 {
-			return newError("Wrong number of arguments! Expected = 1. Received=%d",
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected = 1. Received=%d",
 				len(args))
 		}
+		if args[0].Type() != Item.ARRAY_ITEM {
+			return newKindError(Item.TYPE_ERROR, "Argument to `reverse` must be ARRAY. Received %s", args[0].Type())
+		}
 		arr := args[0].(*Item.Array)
 		for i := 0; i < int(arr.Len/2); i++ {
 			arr.Elements[i], arr.Elements[int(arr.Len)-1-i] = arr.Elements[int(arr.Len)-1-i], arr.Elements[i]
@@ -173,47 +412,259 @@ var builtins = map[string]*Item.Builtin{
 	},
 	},
 
-	"sort": {Fn: func(args ...Item.Item) Item.Item {
-		if len(args) != 1 {
-			return newError("Wrong number of arguments! Expected = 1. Received=%d",
-				len(args))
+	"sort":    {CallbackFn: sortBuiltin},
+	"sort_by": {CallbackFn: sortByBuiltin},
+	"error": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) < 1 || len(args) > 2 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected 1 or 2. Received=%d", len(args))
 		}
-		arr := args[0].(*Item.Array)
-		quicksort(arr, 0, int(arr.Len-1))
-		return arr
+		for _, arg := range args {
+			if arg.Type() != Item.STRING_ITEM {
+				return newKindError(Item.TYPE_ERROR, "Arguments to `error` must be STRING. Received %s", arg.Type())
+			}
+		}
+		value := &Item.ErrorValue{Kind: Item.GENERIC_ERROR, Message: args[0].(*Item.String).Value}
+		if len(args) == 2 {
+			value.Kind = args[1].(*Item.String).Value
+		}
+		return value
 	},
 	},
 }
 
-func quicksort(arr *Item.Array, l int, r int) *Item.Error {
-	if r-l+1 <= 1 {
+// sortBuiltin sorts an array in place with <, or with a comparison function
+// that returns a negative number, zero or a positive number when its first
+// argument is smaller than, equal to or larger than the second.
+func sortBuiltin(call Item.Caller, args ...Item.Item) Item.Item {
+	if len(args) < 1 || len(args) > 2 {
+		return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected 1 or 2. Received=%d", len(args))
+	}
+	arr, ok := args[0].(*Item.Array)
+	if !ok {
+		return newKindError(Item.TYPE_ERROR, "Argument to `sort` must be ARRAY. Received %s", args[0].Type())
+	}
+	less := lessThan
+	if len(args) == 2 {
+		cmp := args[1]
+		less = func(a, b Item.Item) (bool, *Item.Error) {
+			result := call(cmp, a, b)
+			switch result := result.(type) {
+			case *Item.Error:
+				return false, result
+			case *Item.Integer:
+				return result.Value < 0, nil
+			case *Item.BigInt:
+				return result.Value.Sign() < 0, nil
+			case *Item.Float:
+				return result.Value < 0, nil
+			}
+			return false, newKindError(Item.TYPE_ERROR, "comparison function of `sort` must return INTEGER or FLOAT, not %s", result.Type())
+		}
+	}
+	if err := mergeSort(arr.Elements[:arr.Len], less); err != nil {
+		return err
+	}
+	return arr
+}
+
+// sortByBuiltin sorts an array in place by the keys a function returns for
+// its elements, calling it once for every element.
+func sortByBuiltin(call Item.Caller, args ...Item.Item) Item.Item {
+	if len(args) != 2 {
+		return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=2. Received=%d", len(args))
+	}
+	arr, ok := args[0].(*Item.Array)
+	if !ok {
+		return newKindError(Item.TYPE_ERROR, "Argument to `sort_by` must be ARRAY. Received %s", args[0].Type())
+	}
+	pairs := make([]Item.Item, arr.Len)
+	for i, element := range arr.Elements[:arr.Len] {
+		key := call(args[1], element)
+		if isError(key) {
+			return key
+		}
+		pairs[i] = &Item.Array{Elements: []Item.Item{key, element}, Len: 2, Capacity: 2}
+	}
+	err := mergeSort(pairs, func(a, b Item.Item) (bool, *Item.Error) {
+		return lessThan(a.(*Item.Array).Elements[0], b.(*Item.Array).Elements[0])
+	})
+	if err != nil {
+		return err
+	}
+	for i, pair := range pairs {
+		arr.Elements[i] = pair.(*Item.Array).Elements[1]
+	}
+	return arr
+}
+
+func lessThan(a, b Item.Item) (bool, *Item.Error) {
+	result := evalInfixExpression(a, "<", b)
+	if err, ok := result.(*Item.Error); ok {
+		return false, err
+	}
+	return result == TRUE, nil
+}
+
+// mergeSort is a stable sort that stops at the first error less returns.
+func mergeSort(items []Item.Item, less func(a, b Item.Item) (bool, *Item.Error)) *Item.Error {
+	if len(items) < 2 {
 		return nil
 	}
-	if arr.Elements[0].Type() != Item.INTEGER_ITEM {
-		return newError("We can only sort Integer Arrays!")
+	buffer := make([]Item.Item, len(items))
+	var sort func(items, buffer []Item.Item) *Item.Error
+	sort = func(items, buffer []Item.Item) *Item.Error {
+		if len(items) < 2 {
+			return nil
+		}
+		middle := len(items) / 2
+		if err := sort(items[:middle], buffer[:middle]); err != nil {
+			return err
+		}
+		if err := sort(items[middle:], buffer[middle:]); err != nil {
+			return err
+		}
+		copy(buffer, items)
+		i, j, k := 0, middle, 0
+		for ; i < middle && j < len(items); k++ {
+			// take from the right half only when it is strictly smaller
+			smaller, err := less(buffer[j], buffer[i])
+			if err != nil {
+				copy(items, buffer)
+				return err
+			}
+			if smaller {
+				items[k] = buffer[j]
+				j++
+			} else {
+				items[k] = buffer[i]
+				i++
+			}
+		}
+		k += copy(items[k:], buffer[i:middle])
+		copy(items[k:], buffer[j:])
+		return nil
 	}
+	return sort(items, buffer)
+}
 
-	pivot := r
-	pos := l
+// stdFile writes to the file it returns, which puts and eputs look up on every
+// call so that they follow os.Stdout and os.Stderr when those are replaced.
+type stdFile func() *os.File
+
+func (f stdFile) Write(p []byte) (int, error) {
+	return f().Write(p)
+}
 
-	for i := l; i <= r; i++ {
-		if arr.Elements[i].(*Item.Integer).Value < arr.Elements[pivot].(*Item.Integer).Value {
-			swap(arr.Elements, i, pos)
-			pos++
+// Printer returns a builtin like puts that writes its line to w.
+func Printer(w io.Writer) *Item.Builtin {
+	return &Item.Builtin{Fn: func(args ...Item.Item) Item.Item {
+		res := ""
+		first := true
+		for _, arg := range args {
+			if first == false {
+				res += " "
+			}
+			res += arg.Output()
+			first = false
+		}
+		fmt.Fprintln(w, res)
+		return NULL
+	}}
+}
+
+// hashBuiltin returns a builtin that makes an array of one item for every
+// pair of a hash, in the hash's order.
+func hashBuiltin(name string, item func(Item.HashPair) Item.Item) *Item.Builtin {
+	return &Item.Builtin{Fn: func(args ...Item.Item) Item.Item {
+		if len(args) != 1 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=1. Received=%d", len(args))
 		}
+		hash, ok := args[0].(*Item.Hash)
+		if !ok {
+			return newKindError(Item.TYPE_ERROR, "Argument to `%s` must be HASH. Received %s", name, args[0].Type())
+		}
+		pairs := hash.Pairs()
+		elements := make([]Item.Item, len(pairs))
+		for i, pair := range pairs {
+			elements[i] = item(pair)
+		}
+		return &Item.Array{Elements: elements, Len: int64(len(elements)), Capacity: int64(len(elements))}
+	}}
+}
+
+func hashAndKey(name string, args []Item.Item) (*Item.Hash, Item.Hashable, *Item.Error) {
+	if len(args) != 2 {
+		return nil, nil, newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=2. Received=%d.", len(args))
 	}
+	hash, ok := args[0].(*Item.Hash)
+	if !ok {
+		return nil, nil, newKindError(Item.TYPE_ERROR, "Argument to `%s` must be HASH. Received %s", name, args[0].Type())
+	}
+	key, err := Item.ToKey(args[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return hash, key, nil
+}
 
-	swap(arr.Elements, pos, pivot)
+// floatBuiltin wraps a float function of one argument, integers are
+// promoted to float and the result is always a float.
+func floatBuiltin(name string, fn func(float64) float64) *Item.Builtin {
+	return &Item.Builtin{Fn: func(args ...Item.Item) Item.Item {
+		if len(args) != 1 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=1. Received=%d", len(args))
+		}
+		value, ok := toFloat(args[0])
+		if !ok {
+			return newKindError(Item.TYPE_ERROR, "Argument to `%s` must be INTEGER or FLOAT. Received %s", name, args[0].Type())
+		}
+		return &Item.Float{Value: fn(value)}
+	}}
+}
 
-	if err := quicksort(arr, l, pos-1); err != nil {
-		return err
+// intPow stays on int64 while the result fits and finishes on big
+// integers otherwise.
+func intPow(base, exponent int64) Item.Item {
+	result, square := int64(1), base
+	for e := exponent; ; e >>= 1 {
+		if e&1 == 1 {
+			product, ok := mulInt64(result, square)
+			if !ok {
+				break
+			}
+			result = product
+		}
+		if e <= 1 {
+			return &Item.Integer{Value: result}
+		}
+		product, ok := mulInt64(square, square)
+		if !ok {
+			break
+		}
+		square = product
 	}
-	if err := quicksort(arr, pos+1, r); err != nil {
-		return err
+	if CheckedArithmetic {
+		return newKindError(Item.OVERFLOW_ERROR, "integer overflow: pow(%d, %d)", base, exponent)
 	}
-	return nil
+	return bigPow(big.NewInt(base), big.NewInt(exponent))
 }
 
-func swap(elements []Item.Item, i, j int) {
-	elements[i], elements[j] = elements[j], elements[i]
+func bigPow(base, exponent *big.Int) Item.Item {
+	if base.CmpAbs(big.NewInt(1)) <= 0 || exponent.Sign() == 0 {
+		return normalizeBigInt(new(big.Int).Exp(base, exponent, nil))
+	}
+	if !exponent.IsInt64() || exponent.Int64() > maxShift || int64(base.BitLen()-1)*exponent.Int64() > maxShift {
+		return newKindError(Item.OVERFLOW_ERROR, "result of pow(%s, %s) is too large", base, exponent)
+	}
+	return normalizeBigInt(new(big.Int).Exp(base, exponent, nil))
+}
+
+func isNegative(item Item.Item) bool {
+	switch item := item.(type) {
+	case *Item.Integer:
+		return item.Value < 0
+	case *Item.BigInt:
+		return item.Value.Sign() < 0
+	}
+	return false
 }
@@ -0,0 +1,248 @@
+package evaluator
+
+import "sg_interpreter/src/sg/Item"
+
+func init() {
+	for name, builtin := range collectionBuiltins {
+		builtins[name] = builtin
+	}
+}
+
+// collectionBuiltins work on arrays and on everything else a for-in loop can
+// walk, seeing the same values a loop with one variable would. An error from
+// a function they call stops them and is returned.
+var collectionBuiltins = map[string]*Item.Builtin{
+	"map": {CallbackFn: func(call Item.Caller, args ...Item.Item) Item.Item {
+		elements, fn, err := elementsAndFunction("map", args)
+		if err != nil {
+			return err
+		}
+		results := make([]Item.Item, len(elements))
+		for i, element := range elements {
+			results[i] = call(fn, element)
+			if isError(results[i]) {
+				return results[i]
+			}
+		}
+		return newArray(results)
+	}},
+	"filter": {CallbackFn: func(call Item.Caller, args ...Item.Item) Item.Item {
+		elements, fn, err := elementsAndFunction("filter", args)
+		if err != nil {
+			return err
+		}
+		results := []Item.Item{}
+		for _, element := range elements {
+			keep := call(fn, element)
+			if isError(keep) {
+				return keep
+			}
+			if trueLike(keep) {
+				results = append(results, element)
+			}
+		}
+		return newArray(results)
+	}},
+	"reduce": {CallbackFn: func(call Item.Caller, args ...Item.Item) Item.Item {
+		if len(args) < 2 || len(args) > 3 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected 2 or 3. Received=%d.", len(args))
+		}
+		elements, err := iterableElements("reduce", args[0])
+		if err != nil {
+			return err
+		}
+		var accumulator Item.Item
+		if len(args) == 3 {
+			accumulator = args[2]
+		} else if len(elements) == 0 {
+			return newKindError(Item.VALUE_ERROR, "`reduce` of nothing needs an initial value")
+		} else {
+			accumulator, elements = elements[0], elements[1:]
+		}
+		for _, element := range elements {
+			accumulator = call(args[1], accumulator, element)
+			if isError(accumulator) {
+				return accumulator
+			}
+		}
+		return accumulator
+	}},
+	"any": {CallbackFn: func(call Item.Caller, args ...Item.Item) Item.Item {
+		return anyOrAll("any", call, args, true)
+	}},
+	"all": {CallbackFn: func(call Item.Caller, args ...Item.Item) Item.Item {
+		return anyOrAll("all", call, args, false)
+	}},
+	"find": {CallbackFn: func(call Item.Caller, args ...Item.Item) Item.Item {
+		elements, fn, err := elementsAndFunction("find", args)
+		if err != nil {
+			return err
+		}
+		for _, element := range elements {
+			found := call(fn, element)
+			if isError(found) {
+				return found
+			}
+			if trueLike(found) {
+				return element
+			}
+		}
+		return NULL
+	}},
+	"flat_map": {CallbackFn: func(call Item.Caller, args ...Item.Item) Item.Item {
+		elements, fn, err := elementsAndFunction("flat_map", args)
+		if err != nil {
+			return err
+		}
+		results := []Item.Item{}
+		for _, element := range elements {
+			result := call(fn, element)
+			if isError(result) {
+				return result
+			}
+			arr, ok := result.(*Item.Array)
+			if !ok {
+				return newKindError(Item.TYPE_ERROR, "the function given to `flat_map` must return ARRAY, not %s", result.Type())
+			}
+			results = append(results, arr.Elements[:arr.Len]...)
+		}
+		return newArray(results)
+	}},
+	"min_by": {CallbackFn: func(call Item.Caller, args ...Item.Item) Item.Item {
+		return extremeBy("min_by", call, args, false)
+	}},
+	"max_by": {CallbackFn: func(call Item.Caller, args ...Item.Item) Item.Item {
+		return extremeBy("max_by", call, args, true)
+	}},
+	"zip": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) < 2 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected at least 2. Received=%d.", len(args))
+		}
+		columns := make([][]Item.Item, len(args))
+		length := -1
+		for i, arg := range args {
+			elements, err := iterableElements("zip", arg)
+			if err != nil {
+				return err
+			}
+			columns[i] = elements
+			if length < 0 || len(elements) < length {
+				length = len(elements)
+			}
+		}
+		rows := make([]Item.Item, length)
+		for i := range rows {
+			row := make([]Item.Item, len(columns))
+			for j, column := range columns {
+				row[j] = column[i]
+			}
+			rows[i] = newArray(row)
+		}
+		return newArray(rows)
+	}},
+	"enumerate": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) != 1 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=1. Received=%d.", len(args))
+		}
+		elements, err := iterableElements("enumerate", args[0])
+		if err != nil {
+			return err
+		}
+		pairs := make([]Item.Item, len(elements))
+		for i, element := range elements {
+			pairs[i] = newArray([]Item.Item{&Item.Integer{Value: int64(i)}, element})
+		}
+		return newArray(pairs)
+	}},
+}
+
+func newArray(elements []Item.Item) *Item.Array {
+	return &Item.Array{Elements: elements, Len: int64(len(elements)), Capacity: int64(len(elements))}
+}
+
+// iterableElements returns the values a for-in loop with one variable would
+// see. Arrays are copied, so a function that changes the array does not
+// change what the builtin walks over.
+func iterableElements(name string, item Item.Item) ([]Item.Item, *Item.Error) {
+	if arr, ok := item.(*Item.Array); ok {
+		return append([]Item.Item(nil), arr.Elements[:arr.Len]...), nil
+	}
+	iterator, ok := Item.NewIterator(item)
+	if !ok {
+		return nil, newKindError(Item.TYPE_ERROR, "Argument to `%s` must be iterable. Received %s", name, item.Type())
+	}
+	elements := []Item.Item{}
+	for {
+		key, value, ok := iterator.Next()
+		if !ok {
+			return elements, nil
+		}
+		if iterator.Keys {
+			value = key
+		}
+		elements = append(elements, value)
+	}
+}
+
+func elementsAndFunction(name string, args []Item.Item) ([]Item.Item, Item.Item, *Item.Error) {
+	if len(args) != 2 {
+		return nil, nil, newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=2. Received=%d.", len(args))
+	}
+	elements, err := iterableElements(name, args[0])
+	return elements, args[1], err
+}
+
+// anyOrAll looks for an element that is truthy, or whose function result is,
+// when want is true and for one that is not otherwise.
+func anyOrAll(name string, call Item.Caller, args []Item.Item, want bool) Item.Item {
+	if len(args) < 1 || len(args) > 2 {
+		return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected 1 or 2. Received=%d.", len(args))
+	}
+	elements, err := iterableElements(name, args[0])
+	if err != nil {
+		return err
+	}
+	for _, element := range elements {
+		if len(args) == 2 {
+			element = call(args[1], element)
+			if isError(element) {
+				return element
+			}
+		}
+		if trueLike(element) == want {
+			return boolToBoolean(want)
+		}
+	}
+	return boolToBoolean(!want)
+}
+
+// extremeBy returns the first element with the smallest or largest key, or
+// null when there are no elements.
+func extremeBy(name string, call Item.Caller, args []Item.Item, largest bool) Item.Item {
+	elements, fn, err := elementsAndFunction(name, args)
+	if err != nil {
+		return err
+	}
+	var best, bestKey Item.Item = NULL, nil
+	for _, element := range elements {
+		key := call(fn, element)
+		if isError(key) {
+			return key
+		}
+		if bestKey != nil {
+			a, b := key, bestKey
+			if largest {
+				a, b = b, a
+			}
+			better, err := lessThan(a, b)
+			if err != nil {
+				return err
+			}
+			if !better {
+				continue
+			}
+		}
+		best, bestKey = element, key
+	}
+	return best
+}
@@ -2,10 +2,18 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"sg_interpreter/src/sg/Item"
 	"sg_interpreter/src/sg/ast"
+	"sg_interpreter/src/sg/token"
+	"strconv"
 )
 
+// MaxCallDepth limits how deeply function calls may nest, like vm.MaxFrames
+// does for the vm.
+const MaxCallDepth = 1 << 14
+
 var (
 	NULL  = &Item.Null{}
 	TRUE  = &Item.Boolean{Value: true}
@@ -13,11 +21,20 @@ var (
 )
 
 func Eval(node ast.Node, scope *Item.Scope) Item.Item {
+	result := evalNode(node, scope)
+	// Errors take the position of the innermost node they were raised in.
+	if err, ok := result.(*Item.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+	return result
+}
+
+func evalNode(node ast.Node, scope *Item.Scope) Item.Item {
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, scope)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, scope)
+		return evalBlockStatement(node, Item.NewEnclosedScope(scope))
 	case *ast.ExpressionStatement:
 		return Eval(node.Expr, scope)
 	case *ast.ReturnStatement:
@@ -27,15 +44,17 @@ func Eval(node ast.Node, scope *Item.Scope) Item.Item {
 		}
 		return &Item.ReturnValue{Value: val}
 	case *ast.SetStatement:
+		if target, ok := node.Target.(*ast.IndexExpression); ok {
+			return evalIndexAssignment(node, target, scope)
+		}
 		val := Eval(node.Val, scope)
 		if isError(val) {
 			return val
 		}
-		_, b := scope.Get(node.Id.Value)
-		if !b {
-			return newError("Variable %s not defined in current scope!", node.Id.Value)
+		name := node.Target.(*ast.Identifier).Value
+		if !scope.Assign(name, val) {
+			return newKindError(Item.NAME_ERROR, "Variable %s not defined in current scope!", name)
 		}
-		scope.Set(node.Id.Value, val)
 	case *ast.LetStatement:
 		val := Eval(node.Val, scope)
 		if isError(val) {
@@ -46,8 +65,31 @@ func Eval(node ast.Node, scope *Item.Scope) Item.Item {
 			return newError("Variable %s already is defined in this function's scope!", node.Id.Value)
 		}
 		scope.Set(node.Id.Value, val)
+	case *ast.TryStatement:
+		return evalTryStatement(node, scope)
+	case *ast.ThrowStatement:
+		value := Eval(node.Value, scope)
+		if isError(value) {
+			return value
+		}
+		return ThrowOperation(value)
+	case *ast.ImportStatement:
+		return evalImportStatement(node, scope)
+	case *ast.ExportStatement:
+		return Eval(node.Let, scope)
+	case *ast.MemberExpression:
+		left := Eval(node.Left, scope)
+		if isError(left) {
+			return left
+		}
+		return evalMemberExpression(left, node.Name.Value)
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &Item.BigInt{Value: node.Big}
+		}
 		return &Item.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &Item.Float{Value: node.Value}
 	case *ast.StringLiteral:
 		return &Item.String{Value: node.Value}
 	case *ast.Boolean:
@@ -63,6 +105,9 @@ func Eval(node ast.Node, scope *Item.Scope) Item.Item {
 		if isError(left) {
 			return left
 		}
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(left, node.Operator, node.Right, scope)
+		}
 		right := Eval(node.Right, scope)
 		if isError(right) {
 			return right
@@ -72,12 +117,20 @@ func Eval(node ast.Node, scope *Item.Scope) Item.Item {
 		return evalIfExpression(node, scope)
 	case *ast.ForStatement:
 		return evalForStatement(node, scope)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, scope)
+	case *ast.ForInStatement:
+		return evalForInStatement(node, scope)
+	case *ast.BreakStatement:
+		return &Item.Break{Pos: node.Pos()}
+	case *ast.ContinueStatement:
+		return &Item.Continue{Pos: node.Pos()}
 	case *ast.Identifier:
 		return evalIdentifier(node, scope)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &Item.Function{Parameters: params, Body: body, Scope: scope}
+		return &Item.Function{Name: node.Name, Parameters: params, Body: body, Scope: scope}
 	case *ast.CallExpression:
 		function := Eval(node.Function, scope)
 		if isError(function) {
@@ -87,7 +140,11 @@ func Eval(node ast.Node, scope *Item.Scope) Item.Item {
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		var names []string
+		for _, name := range node.Names {
+			names = append(names, name.Value)
+		}
+		return callFunction(function, args, names, scope.CallDepth, node.Pos())
 	case *ast.ArrayLiteral:
 		elements := evalExpression(node.Elements, scope)
 		if len(elements) == 1 && isError(elements[0]) {
@@ -104,6 +161,22 @@ func Eval(node ast.Node, scope *Item.Scope) Item.Item {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.SliceExpression:
+		left := Eval(node.Left, scope)
+		if isError(left) {
+			return left
+		}
+		bounds := [2]Item.Item{NULL, NULL}
+		for i, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				continue
+			}
+			bounds[i] = Eval(bound, scope)
+			if isError(bounds[i]) {
+				return bounds[i]
+			}
+		}
+		return SliceOperation(left, bounds[0], bounds[1])
 
 	case *ast.MapLiteral:
 		return evalMapLiteral(node, scope)
@@ -112,8 +185,14 @@ func Eval(node ast.Node, scope *Item.Scope) Item.Item {
 	return nil
 }
 
-func evalProgram(program *ast.Program, scope *Item.Scope) Item.Item {
-	var res Item.Item
+func evalProgram(program *ast.Program, scope *Item.Scope) (res Item.Item) {
+	// No program should be able to crash the host, a panic is a bug in the
+	// interpreter and is reported like any other runtime error.
+	defer func() {
+		if r := recover(); r != nil {
+			res = newKindError(Item.INTERNAL_ERROR, "internal error: %v", r)
+		}
+	}()
 	for _, statement := range program.Statements {
 		res = Eval(statement, scope)
 		switch result := res.(type) {
@@ -121,6 +200,8 @@ func evalProgram(program *ast.Program, scope *Item.Scope) Item.Item {
 			return result.Value
 		case *Item.Error:
 			return result
+		case *Item.Break, *Item.Continue:
+			return outsideLoop(result)
 		}
 	}
 	return res
@@ -130,10 +211,8 @@ func evalBlockStatement(block *ast.BlockStatement, scope *Item.Scope) Item.Item
 	var res Item.Item
 	for _, statement := range block.Statements {
 		res = Eval(statement, scope)
-		if res != nil {
-			if res.Type() == Item.RETURN_VALUE_ITEM || res.Type() == Item.ERROR_ITEM {
-				return res
-			}
+		if leavesBlock(res) {
+			return res
 		}
 	}
 	return res
@@ -145,8 +224,16 @@ func evalPrefixExpression(operator string, expression Item.Item) Item.Item {
 		return evalEXC(expression)
 	case "-":
 		return evalMINUS(expression)
+	case "~":
+		switch expression := expression.(type) {
+		case *Item.Integer:
+			return &Item.Integer{Value: ^expression.Value}
+		case *Item.BigInt:
+			return normalizeBigInt(new(big.Int).Not(expression.Value))
+		}
+		return newKindError(Item.TYPE_ERROR, "unknown operator: ~%s", expression.Type())
 	default:
-		return newError("unknown operator: %s%s", operator, expression.Type())
+		return newKindError(Item.TYPE_ERROR, "unknown operator: %s%s", operator, expression.Type())
 	}
 }
 
@@ -154,17 +241,36 @@ func evalInfixExpression(left Item.Item, op string, right Item.Item) Item.Item {
 	switch {
 	case left.Type() == Item.INTEGER_ITEM && right.Type() == Item.INTEGER_ITEM:
 		return evalIntegerInfixExpr(left, op, right)
+	case isInteger(left) && isInteger(right):
+		leftVal, _ := toBigInt(left)
+		rightVal, _ := toBigInt(right)
+		if result := evalBigIntInfixExpr(leftVal, op, rightVal); result != nil {
+			return result
+		}
+		return newKindError(Item.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), op, right.Type())
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpr(left, op, right)
 	case left.Type() == Item.STRING_ITEM && right.Type() == Item.STRING_ITEM:
 		return evalStringInfixExpression(left, op, right)
+	case left.Type() == Item.BOOLEAN_ITEM && right.Type() == Item.BOOLEAN_ITEM && (op == "&" || op == "|" || op == "^"):
+		return evalBooleanInfixExpression(left, op, right)
+	case left.Type() == Item.ARRAY_ITEM && right.Type() == Item.ARRAY_ITEM:
+		return evalArrayInfixExpression(left.(*Item.Array), op, right.(*Item.Array))
+	case left.Type() == Item.HASH_ITEM && right.Type() == Item.HASH_ITEM && (op == "==" || op == "!="):
+		same, err := equal(left, right)
+		if err != nil {
+			return err
+		}
+		return boolToBoolean(same == (op == "=="))
 	case op == "==":
 		return boolToBoolean(left == right)
 	case op == "!=":
 		return boolToBoolean(left != right)
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s",
+		return newKindError(Item.TYPE_ERROR, "type mismatch: %s %s %s",
 			left.Type(), op, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newKindError(Item.TYPE_ERROR, "unknown operator: %s %s %s",
 			left.Type(), op, right.Type())
 	}
 }
@@ -183,12 +289,16 @@ func evalEXC(expression Item.Item) Item.Item {
 }
 
 func evalMINUS(expression Item.Item) Item.Item {
-	if expression.Type() != Item.INTEGER_ITEM {
-		return newError("unknown operator: -%s", expression.Type())
+	switch expression := expression.(type) {
+	case *Item.Integer:
+		return negInt(expression.Value)
+	case *Item.BigInt:
+		return normalizeBigInt(new(big.Int).Neg(expression.Value))
+	case *Item.Float:
+		return &Item.Float{Value: -expression.Value}
+	default:
+		return newKindError(Item.TYPE_ERROR, "unknown operator: -%s", expression.Type())
 	}
-
-	val := expression.(*Item.Integer).Value
-	return &Item.Integer{Value: -val}
 }
 
 func evalIntegerInfixExpr(left Item.Item, op string, right Item.Item) Item.Item {
@@ -196,13 +306,77 @@ func evalIntegerInfixExpr(left Item.Item, op string, right Item.Item) Item.Item
 	rightVal := right.(*Item.Integer).Value
 	switch op {
 	case "-":
-		return &Item.Integer{Value: leftVal - rightVal}
+		return subInt(leftVal, rightVal)
+	case "+":
+		return addInt(leftVal, rightVal)
+	case "/", "%":
+		return divInt(leftVal, op, rightVal)
+	case "*":
+		return mulInt(leftVal, rightVal)
+	case "&":
+		return &Item.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &Item.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &Item.Integer{Value: leftVal ^ rightVal}
+	case "<<":
+		return shlInt(leftVal, rightVal)
+	case ">>":
+		if rightVal < 0 {
+			return newKindError(Item.VALUE_ERROR, "negative shift count: %d", rightVal)
+		}
+		return &Item.Integer{Value: leftVal >> uint64(rightVal)}
+	case "==":
+		return boolToBoolean(leftVal == rightVal)
+	case "!=":
+		return boolToBoolean(leftVal != rightVal)
+	case "<":
+		return boolToBoolean(leftVal < rightVal)
+	case ">":
+		return boolToBoolean(leftVal > rightVal)
+	case "<=":
+		return boolToBoolean(leftVal <= rightVal)
+	case ">=":
+		return boolToBoolean(leftVal >= rightVal)
+	}
+	return newKindError(Item.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), op, right.Type())
+}
+
+// evalFloatInfixExpr handles floats and integers mixed with floats, the
+// integers are promoted to float first. Comparisons with integers a float
+// can not hold exactly compare the exact values instead.
+func evalFloatInfixExpr(left Item.Item, op string, right Item.Item) Item.Item {
+	if !exactAsFloat(left) || !exactAsFloat(right) {
+		if cmp, ok := compareExact(left, right); ok {
+			switch op {
+			case "==":
+				return boolToBoolean(cmp == 0)
+			case "!=":
+				return boolToBoolean(cmp != 0)
+			case "<":
+				return boolToBoolean(cmp < 0)
+			case ">":
+				return boolToBoolean(cmp > 0)
+			case "<=":
+				return boolToBoolean(cmp <= 0)
+			case ">=":
+				return boolToBoolean(cmp >= 0)
+			}
+		}
+	}
+	leftVal, _ := toFloat(left)
+	rightVal, _ := toFloat(right)
+	switch op {
+	case "-":
+		return &Item.Float{Value: leftVal - rightVal}
 	case "+":
-		return &Item.Integer{Value: leftVal + rightVal}
+		return &Item.Float{Value: leftVal + rightVal}
 	case "/":
-		return &Item.Integer{Value: leftVal / rightVal}
+		return &Item.Float{Value: leftVal / rightVal}
 	case "*":
-		return &Item.Integer{Value: leftVal * rightVal}
+		return &Item.Float{Value: leftVal * rightVal}
+	case "%":
+		return &Item.Float{Value: math.Mod(leftVal, rightVal)}
 	case "==":
 		return boolToBoolean(leftVal == rightVal)
 	case "!=":
@@ -211,9 +385,42 @@ func evalIntegerInfixExpr(left Item.Item, op string, right Item.Item) Item.Item
 		return boolToBoolean(leftVal < rightVal)
 	case ">":
 		return boolToBoolean(leftVal > rightVal)
+	case "<=":
+		return boolToBoolean(leftVal <= rightVal)
+	case ">=":
+		return boolToBoolean(leftVal >= rightVal)
 	}
-	return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	return newKindError(Item.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), op, right.Type())
 }
+
+func isNumber(item Item.Item) bool {
+	return isInteger(item) || item.Type() == Item.FLOAT_ITEM
+}
+
+func toFloat(item Item.Item) (float64, bool) {
+	switch item := item.(type) {
+	case *Item.Integer:
+		return float64(item.Value), true
+	case *Item.BigInt:
+		value, _ := new(big.Float).SetInt(item.Value).Float64()
+		return value, true
+	case *Item.Float:
+		return item.Value, true
+	}
+	return 0, false
+}
+
+// exactAsFloat reports whether toFloat returns item without rounding it.
+func exactAsFloat(item Item.Item) bool {
+	switch item := item.(type) {
+	case *Item.Integer:
+		return -1<<53 <= item.Value && item.Value <= 1<<53
+	case *Item.Float:
+		return true
+	}
+	return false
+}
+
 func evalStringInfixExpression(left Item.Item, op string, right Item.Item) Item.Item {
 	leftVal := left.(*Item.String).Value
 	rightVal := right.(*Item.String).Value
@@ -229,10 +436,191 @@ func evalStringInfixExpression(left Item.Item, op string, right Item.Item) Item.
 		return boolToBoolean(leftVal < rightVal)
 	case ">":
 		return boolToBoolean(leftVal > rightVal)
+	case "<=":
+		return boolToBoolean(leftVal <= rightVal)
+	case ">=":
+		return boolToBoolean(leftVal >= rightVal)
+	}
+
+	return newKindError(Item.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), op, right.Type())
+}
+func evalArrayInfixExpression(left *Item.Array, op string, right *Item.Array) Item.Item {
+	switch op {
+	case "+":
+		return concatArrays(left, right)
+	case "==", "!=":
+		same, err := equal(left, right)
+		if err != nil {
+			return err
+		}
+		return boolToBoolean(same == (op == "=="))
+	case "<", ">", "<=", ">=":
+		order, err := compareArrays(left, right)
+		if err != nil {
+			return err
+		}
+		switch op {
+		case "<":
+			return boolToBoolean(order < 0)
+		case ">":
+			return boolToBoolean(order > 0)
+		case "<=":
+			return boolToBoolean(order <= 0)
+		default:
+			return boolToBoolean(order >= 0)
+		}
 	}
+	return newKindError(Item.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), op, right.Type())
+}
 
-	return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+// equal compares arrays element by element and hashes key by key, in any
+// order, and everything else with ==. Values nested more than
+// Item.MaxNesting levels deep can't be compared.
+func equal(left, right Item.Item) (bool, *Item.Error) {
+	return deepEqual(left, right, make(map[[2]Item.Item]bool), 0)
 }
+
+// deepEqual remembers the pairs of arrays and hashes it is comparing in
+// seen, and takes a pair it meets again inside itself as equal, so values
+// that contain themselves are compared in finite time. depth is how many
+// arrays and hashes the pair is inside of.
+func deepEqual(left, right Item.Item, seen map[[2]Item.Item]bool, depth int) (bool, *Item.Error) {
+	if left == right {
+		return true, nil
+	}
+	switch l := left.(type) {
+	case *Item.Array:
+		r, ok := right.(*Item.Array)
+		if !ok || l.Len != r.Len {
+			return false, nil
+		}
+		if seen[[2]Item.Item{l, r}] {
+			return true, nil
+		}
+		if depth >= Item.MaxNesting {
+			return false, tooDeep()
+		}
+		seen[[2]Item.Item{l, r}] = true
+		for i := int64(0); i < l.Len; i++ {
+			if same, err := deepEqual(l.Elements[i], r.Elements[i], seen, depth+1); !same || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case *Item.Hash:
+		r, ok := right.(*Item.Hash)
+		if !ok || l.Len() != r.Len() {
+			return false, nil
+		}
+		if seen[[2]Item.Item{l, r}] {
+			return true, nil
+		}
+		if depth >= Item.MaxNesting {
+			return false, tooDeep()
+		}
+		seen[[2]Item.Item{l, r}] = true
+		for _, pair := range l.Pairs() {
+			value, ok := r.Get(pair.Key.(Item.Hashable))
+			if !ok {
+				return false, nil
+			}
+			if same, err := deepEqual(pair.Value, value, seen, depth+1); !same || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return evalInfixExpression(left, "==", right) == TRUE, nil
+}
+
+func tooDeep() *Item.Error {
+	return newKindError(Item.RECURSION_ERROR, "values nested more than %d levels deep can't be compared", Item.MaxNesting)
+}
+
+// compareArrays orders arrays by their first elements that differ, using <
+// on them, or by their length when one starts with the other. Elements
+// neither of which is smaller, like two NaNs, count as the same.
+func compareArrays(left, right *Item.Array) (int, *Item.Error) {
+	return compareArraysOn(left, right, make(map[[2]*Item.Array]bool))
+}
+
+// compareArraysOn is compareArrays with the pairs of arrays already being
+// compared in path. Meeting one of them again, in arrays that contain
+// themselves, compares them as the same so that the comparison ends.
+func compareArraysOn(left, right *Item.Array, path map[[2]*Item.Array]bool) (int, *Item.Error) {
+	pair := [2]*Item.Array{left, right}
+	if path[pair] {
+		return 0, nil
+	}
+	if len(path) >= Item.MaxNesting {
+		return 0, tooDeep()
+	}
+	path[pair] = true
+	defer delete(path, pair)
+	for i := int64(0); i < left.Len && i < right.Len; i++ {
+		a, b := left.Elements[i], right.Elements[i]
+		if a, ok := a.(*Item.Array); ok {
+			if b, ok := b.(*Item.Array); ok {
+				order, err := compareArraysOn(a, b, path)
+				if err != nil || order != 0 {
+					return order, err
+				}
+				continue
+			}
+		}
+		same, err := equal(a, b)
+		if err != nil {
+			return 0, err
+		}
+		if same {
+			continue
+		}
+		for _, order := range []int{-1, 1} {
+			less := evalInfixExpression(a, "<", b)
+			if err, ok := less.(*Item.Error); ok {
+				return 0, err
+			}
+			if less == TRUE {
+				return order, nil
+			}
+			a, b = b, a
+		}
+	}
+	switch {
+	case left.Len < right.Len:
+		return -1, nil
+	case left.Len > right.Len:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func evalBooleanInfixExpression(left Item.Item, op string, right Item.Item) Item.Item {
+	leftVal := left.(*Item.Boolean).Value
+	rightVal := right.(*Item.Boolean).Value
+	switch op {
+	case "&":
+		return boolToBoolean(leftVal && rightVal)
+	case "|":
+		return boolToBoolean(leftVal || rightVal)
+	default:
+		return boolToBoolean(leftVal != rightVal)
+	}
+}
+
+// evalLogicalExpression only evaluates the right side of && and || when the
+// left side does not already decide the result.
+func evalLogicalExpression(left Item.Item, op string, right ast.Expression, scope *Item.Scope) Item.Item {
+	if trueLike(left) == (op == "||") {
+		return boolToBoolean(op == "||")
+	}
+	value := Eval(right, scope)
+	if isError(value) {
+		return value
+	}
+	return boolToBoolean(trueLike(value))
+}
+
 func boolToBoolean(b bool) *Item.Boolean {
 	if b {
 		return TRUE
@@ -257,13 +645,17 @@ func evalIfExpression(is *ast.IfExpression, scope *Item.Scope) Item.Item {
 	if isError(cond) {
 		return cond
 	}
+	var result Item.Item = NULL
 	if trueLike(cond) {
-		return Eval(is.Cons, scope)
+		result = Eval(is.Cons, scope)
 	} else if is.Alt != nil {
-		return Eval(is.Alt, scope)
-	} else {
+		result = Eval(is.Alt, scope)
+	}
+	// a block without a value, like an empty one, gives null
+	if result == nil {
 		return NULL
 	}
+	return result
 }
 
 func evalIdentifier(
@@ -278,7 +670,7 @@ func evalIdentifier(
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newKindError(Item.NAME_ERROR, "identifier not found: "+node.Value)
 }
 
 func evalExpression(expressions []ast.Expression, scope *Item.Scope) []Item.Item {
@@ -292,27 +684,147 @@ func evalExpression(expressions []ast.Expression, scope *Item.Scope) []Item.Item
 	}
 	return res
 }
-func applyFunction(fn Item.Item, args []Item.Item) Item.Item {
+
+// callFunction calls fn from code callDepth calls deep, at callPos. The last
+// len(names) arguments are passed by name.
+func callFunction(function Item.Item, args []Item.Item, names []string, callDepth int, callPos token.Position) Item.Item {
+	if fn, ok := function.(*Item.Function); ok {
+		values, err := BindArguments(fn.Parameters, args, names)
+		if err != nil {
+			return err
+		}
+		args, names = values, nil
+	}
+	// the program itself takes the first frame, as in the vm
+	if callDepth >= MaxCallDepth-1 {
+		return newKindError(Item.RECURSION_ERROR, "stack overflow: more than %d nested calls", MaxCallDepth)
+	}
+	result := applyFunction(function, args, names, callDepth+1, callPos)
+	if err, ok := result.(*Item.Error); ok {
+		if fn, ok := function.(*Item.Function); ok {
+			err.Trace = append(err.Trace, Item.StackFrame{Function: Item.FunctionName(fn.Name), CallPos: callPos})
+		}
+	}
+	return result
+}
+
+// applyFunction runs fn. An SG function gets the values of its parameters
+// as BindArguments returns them instead of the arguments of the call.
+func applyFunction(fn Item.Item, args []Item.Item, names []string, callDepth int, callPos token.Position) Item.Item {
 	switch fn := fn.(type) {
 
 	case *Item.Function:
-		extendedEnv := extendedScope(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
+		extendedEnv, err := extendedScope(fn, args, callDepth)
+		if err != nil {
+			return err
+		}
+		// the body shares its scope with the parameters
+		evaluated := evalBlockStatement(fn.Body, extendedEnv)
+		if leavesLoop(evaluated) {
+			return outsideLoop(evaluated)
+		}
+		if evaluated == nil {
+			return NULL
+		}
 		return unwrapReturnValue(evaluated)
 	case *Item.Builtin:
-		return fn.Fn(args...)
+		if len(names) > 0 {
+			return newKindError(Item.ARGUMENT_ERROR, "builtin functions take no named arguments")
+		}
+		// like in the vm, a builtin takes no frame of its own
+		return fn.Call(func(callback Item.Item, args ...Item.Item) Item.Item {
+			return callFunction(callback, args, nil, callDepth-1, callPos)
+		}, args...)
 
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newKindError(Item.TYPE_ERROR, "not a function: %s", fn.Type())
 	}
 }
-func extendedScope(function *Item.Function, args []Item.Item) *Item.Scope {
+
+// extendedScope binds the parameters of function to values, in order, so a
+// default value is evaluated seeing the parameters before it.
+func extendedScope(function *Item.Function, values []Item.Item, callDepth int) (*Item.Scope, Item.Item) {
 	scope := Item.NewEnclosedScope(function.Scope)
-	for paramIdx, param := range function.Parameters {
-		scope.Set(param.Value, args[paramIdx])
+	scope.CallDepth = callDepth
+	for i, parameter := range function.Parameters {
+		value := values[i]
+		if value == nil {
+			value = Eval(parameter.Default, scope)
+			if isError(value) {
+				return nil, value
+			}
+		}
+		scope.Set(parameter.Name.Value, value)
+	}
+	return scope, nil
+}
+
+// BindArguments matches the arguments of a call to the parameters of a
+// function, the last len(names) arguments being passed by name. It returns
+// the value of every parameter, nil for the ones left to their default. The
+// rest parameter gets an array of the positional arguments left over.
+func BindArguments(parameters []*ast.Parameter, args []Item.Item, names []string) ([]Item.Item, *Item.Error) {
+	values := make([]Item.Item, len(parameters))
+	fixed := parameters
+	if n := len(parameters); n > 0 && parameters[n-1].Rest {
+		fixed = parameters[:n-1]
+		values[n-1] = newArray([]Item.Item{})
+	}
+	positional := args[:len(args)-len(names)]
+	if len(positional) > len(fixed) {
+		if len(fixed) == len(parameters) {
+			return nil, arityError(parameters, len(args))
+		}
+		values[len(fixed)] = newArray(append([]Item.Item{}, positional[len(fixed):]...))
+		positional = positional[:len(fixed)]
+	}
+	copy(values, positional)
+	for i, name := range names {
+		j := 0
+		for j < len(fixed) && fixed[j].Name.Value != name {
+			j++
+		}
+		if j == len(fixed) {
+			return nil, newKindError(Item.ARGUMENT_ERROR, "unexpected argument %s", name)
+		}
+		if values[j] != nil {
+			return nil, newKindError(Item.ARGUMENT_ERROR, "argument %s given twice", name)
+		}
+		values[j] = args[len(positional)+i]
+	}
+	for i, parameter := range fixed {
+		if values[i] == nil && parameter.Default == nil {
+			if len(names) == 0 {
+				return nil, arityError(parameters, len(args))
+			}
+			return nil, newKindError(Item.ARGUMENT_ERROR, "missing argument %s", parameter.Name.Value)
+		}
 	}
-	return scope
+	return values, nil
 }
+
+func arityError(parameters []*ast.Parameter, got int) *Item.Error {
+	required, optional, rest := 0, 0, false
+	for _, parameter := range parameters {
+		switch {
+		case parameter.Rest:
+			rest = true
+		case parameter.Default != nil:
+			optional++
+		default:
+			required++
+		}
+	}
+	want := strconv.Itoa(required)
+	switch {
+	case rest:
+		want = "at least " + want
+	case optional > 0:
+		want = fmt.Sprintf("%d to %d", required, required+optional)
+	}
+	return newKindError(Item.ARGUMENT_ERROR, "wrong number of arguments: want=%s, got=%d", want, got)
+}
+
 func unwrapReturnValue(item Item.Item) Item.Item {
 	if returnValue, ok := item.(*Item.ReturnValue); ok {
 		return returnValue.Value
@@ -323,6 +835,10 @@ func unwrapReturnValue(item Item.Item) Item.Item {
 func newError(format string, a ...interface{}) *Item.Error {
 	return &Item.Error{Message: fmt.Sprintf(format, a...)}
 }
+
+func newKindError(kind string, format string, a ...interface{}) *Item.Error {
+	return &Item.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
 func isError(item Item.Item) bool {
 	if item != nil {
 		return item.Type() == Item.ERROR_ITEM
@@ -333,7 +849,7 @@ func isError(item Item.Item) bool {
 func evalArrayIndexExpression(array, index Item.Item) Item.Item {
 	arrayObject := array.(*Item.Array)
 	idx := index.(*Item.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+	max := arrayObject.Len - 1
 
 	if idx < 0 || idx > max {
 		return NULL
@@ -346,58 +862,174 @@ func evalMapLiteral(
 	node *ast.MapLiteral,
 	env *Item.Scope,
 ) Item.Item {
-	pairs := make(map[Item.HashKey]Item.HashPair)
+	hash := Item.NewHash()
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
 		if isError(key) {
 			return key
 		}
 
-		hashKey, ok := key.(Item.Hashable)
-		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+		hashKey, err := Item.ToKey(key)
+		if err != nil {
+			return err
 		}
 
-		value := Eval(valueNode, env)
+		value := Eval(pair.Value, env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = Item.HashPair{Key: key, Value: value}
+		hash.Set(hashKey, value)
 	}
 
-	return &Item.Hash{Pairs: pairs}
+	return hash
 }
 
 func evalMapIndexExpression(hash, index Item.Item) Item.Item {
 	hashObject := hash.(*Item.Hash)
 
-	key, ok := index.(Item.Hashable)
-	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+	key, err := Item.ToKey(index)
+	if err != nil {
+		return err
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(key)
 	if !ok {
 		return NULL
 	}
 
-	return pair.Value
+	return value
 }
+func evalIndexAssignment(node *ast.SetStatement, target *ast.IndexExpression, scope *Item.Scope) Item.Item {
+	left := Eval(target.Left, scope)
+	if isError(left) {
+		return left
+	}
+	index := Eval(target.Index, scope)
+	if isError(index) {
+		return index
+	}
+	var current Item.Item
+	if node.Operator != "" {
+		current = evalIndexExpression(left, index)
+		if isError(current) {
+			return current
+		}
+	}
+	val := Eval(node.Val, scope)
+	if isError(val) {
+		return val
+	}
+	if node.Operator != "" {
+		val = evalInfixExpression(current, node.Operator, val)
+		if isError(val) {
+			return val
+		}
+	}
+	return SetIndexOperation(left, index, val)
+}
+
+// SetIndexOperation stores value at index of an array or hash. Arrays must
+// already have the index, hashes get a new key. It returns nil or an error.
+func SetIndexOperation(left, index, value Item.Item) Item.Item {
+	switch left := left.(type) {
+	case *Item.Array:
+		idx, ok := index.(*Item.Integer)
+		if !ok {
+			return newKindError(Item.TYPE_ERROR, "array index must be INTEGER, not %s", index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= left.Len {
+			return newKindError(Item.INDEX_ERROR, "index %d out of range for array of length %d", idx.Value, left.Len)
+		}
+		left.Elements[idx.Value] = value
+	case *Item.Hash:
+		key, err := Item.ToKey(index)
+		if err != nil {
+			return err
+		}
+		left.Set(key, value)
+	default:
+		return newKindError(Item.TYPE_ERROR, "index assignment not supported: %s", left.Type())
+	}
+	return nil
+}
+
 func evalIndexExpression(left, index Item.Item) Item.Item {
 	switch {
 	case left.Type() == Item.ARRAY_ITEM && index.Type() == Item.INTEGER_ITEM:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == Item.STRING_ITEM && index.Type() == Item.INTEGER_ITEM:
+		// strings are indexed by byte, not by character
+		s := left.(*Item.String).Value
+		idx := index.(*Item.Integer).Value
+		if idx < 0 || idx >= int64(len(s)) {
+			return NULL
+		}
+		return &Item.String{Value: s[idx : idx+1]}
 	case left.Type() == Item.HASH_ITEM:
 		return evalMapIndexExpression(left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newKindError(Item.TYPE_ERROR, "index operator not supported: %s", left.Type())
+	}
+}
+
+// SliceOperation returns the part of a string from start up to end, which
+// are null when they are left out. Negative bounds count from the end and
+// bounds past either end are moved to it.
+func SliceOperation(left, start, end Item.Item) Item.Item {
+	var length int64
+	switch left := left.(type) {
+	case *Item.String:
+		length = int64(len(left.Value))
+	case *Item.Array:
+		length = left.Len
+	default:
+		return newKindError(Item.TYPE_ERROR, "slice operator not supported: %s", left.Type())
 	}
+	from, err := sliceBound(start, 0, length)
+	if err != nil {
+		return err
+	}
+	to, err := sliceBound(end, length, length)
+	if err != nil {
+		return err
+	}
+	if from > to {
+		to = from
+	}
+	if arr, ok := left.(*Item.Array); ok {
+		// a slice is a new array, changing it leaves the original alone
+		return newArray(append([]Item.Item{}, arr.Elements[from:to]...))
+	}
+	return &Item.String{Value: left.(*Item.String).Value[from:to]}
 }
+
+func sliceBound(bound Item.Item, missing int64, length int64) (int64, *Item.Error) {
+	if bound == NULL {
+		return missing, nil
+	}
+	integer, ok := bound.(*Item.Integer)
+	if !ok {
+		return 0, newKindError(Item.TYPE_ERROR, "slice bounds must be INTEGER, not %s", bound.Type())
+	}
+	value := integer.Value
+	if value < 0 {
+		value += length
+	}
+	if value < 0 {
+		return 0, nil
+	}
+	if value > length {
+		return length, nil
+	}
+	return value, nil
+}
+
 func evalForStatement(fs *ast.ForStatement, scope *Item.Scope) Item.Item {
-	// Execute the initializer in the current scope
+	// The initializer's variables live in a scope of the loop's own, the body
+	// block gets a fresh scope inside it on every iteration.
+	scope = Item.NewEnclosedScope(scope)
 	if fs.Initializer != nil {
 		initialization := Eval(fs.Initializer, scope)
 		if isError(initialization) {
@@ -408,20 +1040,29 @@ func evalForStatement(fs *ast.ForStatement, scope *Item.Scope) Item.Item {
 	var result Item.Item = NULL
 
 	for {
-		iterationScope := Item.NewEnclosedScope(scope)
+		if fs.Condition != nil {
+			condition := Eval(fs.Condition, scope)
+			if isError(condition) {
+				return condition
+			}
+			if !trueLike(condition) {
+				break
+			}
+		}
 
-		condition := Eval(fs.Condition, iterationScope)
-		if isError(condition) {
-			return condition
+		result = Eval(fs.Body, scope)
+		if _, ok := result.(*Item.Break); ok {
+			return NULL
 		}
-		if !trueLike(condition) {
-			break
+		if _, ok := result.(*Item.Continue); ok {
+			result = NULL
 		}
-
-		result = Eval(fs.Body, iterationScope)
 		if isError(result) {
 			return result
 		}
+		if result != nil && result.Type() == Item.RETURN_VALUE_ITEM {
+			return result
+		}
 
 		if fs.Post != nil {
 			post := Eval(fs.Post, scope)
@@ -431,5 +1072,180 @@ func evalForStatement(fs *ast.ForStatement, scope *Item.Scope) Item.Item {
 		}
 	}
 
-	return result
+	// a loop has no value, like the other statements that are not expressions,
+	// even when its body ends with one
+	return NULL
+}
+
+func evalWhileStatement(ws *ast.WhileStatement, scope *Item.Scope) Item.Item {
+	var result Item.Item = NULL
+
+	for {
+		condition := Eval(ws.Condition, scope)
+		if isError(condition) {
+			return condition
+		}
+		if !trueLike(condition) {
+			break
+		}
+
+		result = Eval(ws.Body, scope)
+		if _, ok := result.(*Item.Break); ok {
+			return NULL
+		}
+		if _, ok := result.(*Item.Continue); ok {
+			result = NULL
+		}
+		if isError(result) {
+			return result
+		}
+		if result != nil && result.Type() == Item.RETURN_VALUE_ITEM {
+			return result
+		}
+	}
+
+	return NULL
+}
+
+// evalTryStatement runs the catch block for an error raised in the body and
+// the finally block in any case. When the finally block leaves the statement
+// itself, by an error, return, break or continue, that wins over how the
+// body or the catch block left it.
+func evalTryStatement(ts *ast.TryStatement, scope *Item.Scope) Item.Item {
+	result := Eval(ts.Body, scope)
+	if err, ok := result.(*Item.Error); ok && ts.Catch != nil {
+		// like a function body, the catch block shares its scope with e
+		catchScope := Item.NewEnclosedScope(scope)
+		if ts.Param != nil {
+			catchScope.Set(ts.Param.Value, err.Value())
+		}
+		result = evalBlockStatement(ts.Catch, catchScope)
+	}
+	if ts.Finally != nil {
+		if finally := Eval(ts.Finally, scope); leavesBlock(finally) {
+			return finally
+		}
+	}
+	if leavesBlock(result) {
+		return result
+	}
+	return NULL
+}
+
+// leavesLoop reports whether result is a break or a continue.
+func leavesLoop(result Item.Item) bool {
+	switch result.(type) {
+	case *Item.Break, *Item.Continue:
+		return true
+	}
+	return false
+}
+
+// outsideLoop is the error for a break or continue with no loop around it.
+func outsideLoop(result Item.Item) *Item.Error {
+	err := newError("%s outside loop", result.Output())
+	switch result := result.(type) {
+	case *Item.Break:
+		err.Pos = result.Pos
+	case *Item.Continue:
+		err.Pos = result.Pos
+	}
+	return err
+}
+
+func leavesBlock(result Item.Item) bool {
+	if result == nil {
+		return false
+	}
+	switch result.Type() {
+	case Item.RETURN_VALUE_ITEM, Item.ERROR_ITEM, Item.BREAK_ITEM, Item.CONTINUE_ITEM:
+		return true
+	}
+	return false
+}
+
+// ThrowOperation raises an error value again, a string is raised as an
+// error with that message.
+func ThrowOperation(value Item.Item) Item.Item {
+	switch value := value.(type) {
+	case *Item.ErrorValue:
+		return value.Raise()
+	case *Item.String:
+		return &Item.Error{Kind: Item.GENERIC_ERROR, Message: value.Value}
+	}
+	return newKindError(Item.TYPE_ERROR, "can only throw ERROR_VALUE or STRING, not %s", value.Type())
+}
+
+func evalForInStatement(fs *ast.ForInStatement, scope *Item.Scope) Item.Item {
+	iterable := Eval(fs.Iterable, scope)
+	if isError(iterable) {
+		return iterable
+	}
+	iterator, ok := Item.NewIterator(iterable)
+	if !ok {
+		return newKindError(Item.TYPE_ERROR, "cannot iterate over %s", iterable.Type())
+	}
+
+	var result Item.Item = NULL
+
+	for {
+		key, value, ok := iterator.Next()
+		if !ok {
+			break
+		}
+		// A fresh scope per iteration gives closures their own copy of the variables.
+		iterationScope := Item.NewEnclosedScope(scope)
+		if fs.Key != nil {
+			iterationScope.Set(fs.Key.Value, key)
+			iterationScope.Set(fs.Value.Value, value)
+		} else if iterator.Keys {
+			iterationScope.Set(fs.Value.Value, key)
+		} else {
+			iterationScope.Set(fs.Value.Value, value)
+		}
+
+		result = Eval(fs.Body, iterationScope)
+		if _, ok := result.(*Item.Break); ok {
+			return NULL
+		}
+		if _, ok := result.(*Item.Continue); ok {
+			result = NULL
+		}
+		if isError(result) {
+			return result
+		}
+		if result != nil && result.Type() == Item.RETURN_VALUE_ITEM {
+			return result
+		}
+	}
+
+	return NULL
+}
+
+// The helpers below expose the evaluator's semantics to the bytecode vm,
+// so both backends agree on every operator, index and builtin.
+
+func InfixOperation(left Item.Item, op string, right Item.Item) Item.Item {
+	return evalInfixExpression(left, op, right)
+}
+
+func PrefixOperation(op string, right Item.Item) Item.Item {
+	return evalPrefixExpression(op, right)
+}
+
+func IndexOperation(left, index Item.Item) Item.Item {
+	return evalIndexExpression(left, index)
+}
+
+func IsTruthy(item Item.Item) bool {
+	return trueLike(item)
+}
+
+func MemberOperation(left Item.Item, name string) Item.Item {
+	return evalMemberExpression(left, name)
+}
+
+func LookupBuiltin(name string) (*Item.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
 }
@@ -0,0 +1,125 @@
+package evaluator_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sg_interpreter/src/sg/Item"
+	"sg_interpreter/src/sg/compiler"
+	"sg_interpreter/src/sg/evaluator"
+	"sg_interpreter/src/sg/lexer"
+	"sg_interpreter/src/sg/parser"
+	"sg_interpreter/src/sg/vm"
+	"strings"
+	"testing"
+)
+
+// unbounded matches the programs FuzzEval skips. Neither backend can be
+// stopped from outside, so a loop that never ends would hang the fuzzer, and
+// make can build arrays of gigabytes.
+var unbounded = regexp.MustCompile(`\b(while|for|make)\b`)
+
+// FuzzEval runs every program that parses on both backends. Neither may
+// panic or fail with an internal error, and both have to print the same
+// thing and end with the same result.
+func FuzzEval(f *testing.F) {
+	for _, seed := range []string{
+		"puts(1 + 2 * 3)",
+		"let a = []\npush(a, a)\nputs(a)",
+		"let h = {}\nh[\"x\"] = h\nputs(h)",
+		"let a = []\npush(a, a)\nputs(sort([a, a]))",
+		"let f = fun(n) { if (n < 2) { return n }; f(n - 1) + f(n - 2) }\nputs(f(15))",
+		"fun g(a, b = a * 2, ...rest) { [a, b, rest] }\nputs(g(1), g(1, b = 5), g(1, 2, 3, 4))",
+		"try { [1, 2][5] = 0 } catch (e) { puts(e.type, e.message) } finally { puts(\"done\") }",
+		"puts(pow(2, 100) % 7, 9223372036854775807 + 1, 1 / 0.0)",
+		"puts({1: \"a\", 1.0: \"b\", [1]: \"c\"})",
+		"puts(map(\"abc\", fun(c) { c + c }), reduce(range(5), fun(a, b) { a + b }))",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, source string) {
+		if len(source) > 1000 || unbounded.MatchString(source) {
+			t.Skip()
+		}
+		p := parser.New(lexer.NewWithFile(source, "fuzz.sg"))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		evalOut, evalResult := capture(t, func() Item.Item {
+			globals := Item.NewScope()
+			globals.Modules = Item.NewModules(globals, nil)
+			return evaluator.Eval(program, Item.NewEnclosedScope(globals))
+		})
+		checkNotInternal(t, "eval", evalResult)
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			// The vm may only refuse a program the evaluator can't run
+			// either. Compile errors have no kind, but they start with
+			// the position, which has to be where the evaluator stopped.
+			evalErr, ok := evalResult.(*Item.Error)
+			if !ok || !strings.HasPrefix(err.Error(), evalErr.Pos.String()+": ") {
+				t.Fatalf("the vm refused the program: %v\neval: %s", err, describe(evalResult))
+			}
+			return
+		}
+		var runErr error
+		vmOut, vmResult := capture(t, func() Item.Item {
+			machine := vm.New(comp.Bytecode())
+			machine.SetModules(Item.NewModules(Item.NewScope(), nil))
+			runErr = machine.Run()
+			return machine.Result()
+		})
+		if runErr != nil {
+			t.Fatalf("vm failed: %v", runErr)
+		}
+		checkNotInternal(t, "vm", vmResult)
+
+		if evalOut != vmOut {
+			t.Errorf("the backends print different things\neval: %q\nvm:   %q", evalOut, vmOut)
+		}
+		if got, want := describe(vmResult), describe(evalResult); got != want {
+			t.Errorf("the backends end differently\neval: %s\nvm:   %s", want, got)
+		}
+	})
+}
+
+// capture runs run with os.Stdout going to a file and returns what was
+// printed along with the result.
+func capture(t *testing.T, run func() Item.Item) (string, Item.Item) {
+	path := filepath.Join(t.TempDir(), "stdout")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	stdout := os.Stdout
+	os.Stdout = file
+	defer func() { os.Stdout = stdout }()
+	result := run()
+	printed, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(printed), result
+}
+
+func checkNotInternal(t *testing.T, engine string, result Item.Item) {
+	if err, ok := result.(*Item.Error); ok && err.Kind == Item.INTERNAL_ERROR {
+		t.Fatalf("%s: %s", engine, err.Traceback())
+	}
+}
+
+// describe tells how a program ended. Ending without a value is ending with
+// null.
+func describe(result Item.Item) string {
+	switch result := result.(type) {
+	case nil:
+		return describe(evaluator.NULL)
+	case *Item.Error:
+		return result.Traceback()
+	}
+	return string(result.Type()) + " " + result.Output()
+}
@@ -0,0 +1,168 @@
+package evaluator
+
+import (
+	"os"
+	"path/filepath"
+	"sg_interpreter/src/sg/Item"
+	"sg_interpreter/src/sg/ast"
+	"sg_interpreter/src/sg/lexer"
+	"sg_interpreter/src/sg/parser"
+	"sg_interpreter/src/sg/token"
+	"strings"
+)
+
+func evalImportStatement(node *ast.ImportStatement, scope *Item.Scope) Item.Item {
+	// checked first, so that a module bound to a name already in use is not
+	// run at all
+	if _, defined := scope.Mp[node.Name.Value]; defined {
+		return newError("Variable %s already is defined in this function's scope!", node.Name.Value)
+	}
+	if scope.Modules == nil {
+		scope.Modules = Item.NewModules(Item.NewScope(), nil)
+	}
+	module := ImportModule(scope.Modules, node.Path, node.Pos(), evalModule(scope.Modules, scope.CallDepth))
+	if isError(module) {
+		return module
+	}
+	scope.Set(node.Name.Value, module)
+	return nil
+}
+
+// A ModuleRunner runs the program of a module file imported at from and
+// returns the variables it defined, or the error that stopped it with the
+// module as the last frame of its trace. The evaluator and the vm each have
+// their own.
+type ModuleRunner func(program *ast.Program, file string, from token.Position) (Item.Variables, *Item.Error)
+
+// ImportModule returns the module for path, running the file with run the
+// first time it is imported. Relative paths are looked up next to the
+// importing file, the one from is in, and then in the search path.
+func ImportModule(modules *Item.Modules, path string, from token.Position, run ModuleRunner) Item.Item {
+	file, searched := findModule(modules, path, from.File)
+	if file == "" {
+		return newKindError(Item.IMPORT_ERROR, "module %q not found, searched %s", path, strings.Join(searched, ", "))
+	}
+	key, err := filepath.Abs(file)
+	if err != nil {
+		return newKindError(Item.IMPORT_ERROR, "can't import %q: %s", path, err)
+	}
+	if module, ok := modules.Loaded(key); ok {
+		return module
+	}
+	if cycle, ok := modules.Begin(key, file); !ok {
+		return newKindError(Item.IMPORT_ERROR, "import cycle: %s", cycle)
+	}
+	module := loadModule(path, file, from, run)
+	if err, ok := module.(*Item.Error); ok {
+		modules.End(key, nil)
+		return err
+	}
+	modules.End(key, module.(*Item.Module))
+	return module
+}
+
+// findModule returns the file path refers to, or "" and the directories
+// that were searched.
+func findModule(modules *Item.Modules, path string, from string) (string, []string) {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+		return "", []string{filepath.Dir(path)}
+	}
+	dir := "."
+	// programs from -e or stdin have names like <stdin> and no directory
+	if from != "" && !strings.HasPrefix(from, "<") {
+		dir = filepath.Dir(from)
+	}
+	dirs := append([]string{dir}, modules.SearchPath...)
+	for _, dir := range dirs {
+		candidate := filepath.Join(dir, path)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", dirs
+}
+
+func loadModule(path string, file string, from token.Position, run ModuleRunner) Item.Item {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return moduleError(newKindError(Item.IMPORT_ERROR, "can't import %q: %s", path, err), file, from)
+	}
+	p := parser.New(lexer.NewWithFile(string(source), file))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return moduleError(newKindError(Item.IMPORT_ERROR, "can't import %q: %s", path, strings.Join(p.Errors(), "; ")), file, from)
+	}
+
+	variables, runErr := run(program, file, from)
+	if runErr != nil {
+		return runErr
+	}
+
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	module := &Item.Module{Name: name, Path: file, Variables: variables, Exports: make(map[string]bool)}
+	for _, statement := range program.Statements {
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			module.Exports[export.Let.Id.Value] = true
+		}
+	}
+	return module
+}
+
+// evalModule returns the runner that evaluates a module in a scope of its
+// own inside the host's globals. Like a call, and like in the vm, the module
+// takes a frame on top of the callDepth calls running where it is imported.
+func evalModule(modules *Item.Modules, callDepth int) ModuleRunner {
+	return func(program *ast.Program, file string, from token.Position) (Item.Variables, *Item.Error) {
+		if callDepth >= MaxCallDepth-1 {
+			return nil, newKindError(Item.RECURSION_ERROR, "stack overflow: more than %d nested calls", MaxCallDepth)
+		}
+		scope := Item.NewEnclosedScope(modules.Globals)
+		scope.Modules = modules
+		scope.CallDepth = callDepth + 1
+		if result := Eval(program, scope); isError(result) {
+			return nil, moduleError(result.(*Item.Error), file, from)
+		}
+		return scope, nil
+	}
+}
+
+// moduleError adds the module file imported at from to the trace of err.
+func moduleError(err *Item.Error, file string, from token.Position) *Item.Error {
+	err.Trace = append(err.Trace, Item.StackFrame{Function: "<module " + file + ">", CallPos: from})
+	return err
+}
+
+func evalMemberExpression(left Item.Item, name string) Item.Item {
+	if err, ok := left.(*Item.ErrorValue); ok {
+		return errorMember(err, name)
+	}
+	module, ok := left.(*Item.Module)
+	if !ok {
+		return newKindError(Item.TYPE_ERROR, "%s has no members, can't get %s", left.Type(), name)
+	}
+	if !module.Exports[name] {
+		return newKindError(Item.NAME_ERROR, "module %s does not export %s", module.Name, name)
+	}
+	value, _ := module.Variables.Get(name)
+	return value
+}
+
+func errorMember(err *Item.ErrorValue, name string) Item.Item {
+	switch name {
+	case "message":
+		return &Item.String{Value: err.Message}
+	case "type":
+		return &Item.String{Value: err.Kind}
+	case "file":
+		return &Item.String{Value: err.Pos.File}
+	case "line":
+		return &Item.Integer{Value: int64(err.Pos.Line)}
+	case "column":
+		return &Item.Integer{Value: int64(err.Pos.Column)}
+	}
+	return newKindError(Item.NAME_ERROR, "%s has no member %s", err.Type(), name)
+}
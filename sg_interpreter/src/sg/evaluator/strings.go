@@ -0,0 +1,207 @@
+package evaluator
+
+import (
+	"sg_interpreter/src/sg/Item"
+	"strings"
+)
+
+// maxStringLength bounds the strings repeat builds, so a large count is an
+// error instead of running out of memory.
+const maxStringLength = 1 << 30
+
+func init() {
+	for name, builtin := range stringBuiltins {
+		builtins[name] = builtin
+	}
+}
+
+var stringBuiltins = map[string]*Item.Builtin{
+	"split": {Fn: func(args ...Item.Item) Item.Item {
+		s, err := stringArgs("split", args, 1, 2)
+		if err != nil {
+			return err
+		}
+		var parts []string
+		if len(s) == 1 {
+			parts = strings.Fields(s[0])
+		} else {
+			parts = strings.Split(s[0], s[1])
+		}
+		elements := make([]Item.Item, len(parts))
+		for i, part := range parts {
+			elements[i] = &Item.String{Value: part}
+		}
+		return &Item.Array{Elements: elements, Len: int64(len(elements)), Capacity: int64(len(elements))}
+	}},
+	"join": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) != 2 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=2. Received=%d.", len(args))
+		}
+		arr, ok := args[0].(*Item.Array)
+		if !ok {
+			return newKindError(Item.TYPE_ERROR, "First argument to `join` must be ARRAY. Received %s", args[0].Type())
+		}
+		sep, ok := args[1].(*Item.String)
+		if !ok {
+			return newKindError(Item.TYPE_ERROR, "Second argument to `join` must be STRING. Received %s", args[1].Type())
+		}
+		parts := make([]string, arr.Len)
+		for i, element := range arr.Elements[:arr.Len] {
+			part, ok := element.(*Item.String)
+			if !ok {
+				return newKindError(Item.TYPE_ERROR, "`join` needs an array of STRING, element %d is %s", i, element.Type())
+			}
+			parts[i] = part.Value
+		}
+		return &Item.String{Value: strings.Join(parts, sep.Value)}
+	}},
+	"index_of": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) == 2 {
+			if arr, ok := args[0].(*Item.Array); ok {
+				index, err := arrayIndex(arr, args[1])
+				if err != nil {
+					return err
+				}
+				return &Item.Integer{Value: index}
+			}
+		}
+		s, err := stringArgs("index_of", args, 2, 2)
+		if err != nil {
+			return err
+		}
+		return &Item.Integer{Value: int64(strings.Index(s[0], s[1]))}
+	}},
+	"contains": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) == 2 {
+			if arr, ok := args[0].(*Item.Array); ok {
+				index, err := arrayIndex(arr, args[1])
+				if err != nil {
+					return err
+				}
+				return boolToBoolean(index >= 0)
+			}
+		}
+		s, err := stringArgs("contains", args, 2, 2)
+		if err != nil {
+			return err
+		}
+		return boolToBoolean(strings.Contains(s[0], s[1]))
+	}},
+	"starts_with": {Fn: func(args ...Item.Item) Item.Item {
+		s, err := stringArgs("starts_with", args, 2, 2)
+		if err != nil {
+			return err
+		}
+		return boolToBoolean(strings.HasPrefix(s[0], s[1]))
+	}},
+	"ends_with": {Fn: func(args ...Item.Item) Item.Item {
+		s, err := stringArgs("ends_with", args, 2, 2)
+		if err != nil {
+			return err
+		}
+		return boolToBoolean(strings.HasSuffix(s[0], s[1]))
+	}},
+	"replace": {Fn: func(args ...Item.Item) Item.Item {
+		s, err := stringArgs("replace", args, 3, 3)
+		if err != nil {
+			return err
+		}
+		return &Item.String{Value: strings.ReplaceAll(s[0], s[1], s[2])}
+	}},
+	"upper": {Fn: func(args ...Item.Item) Item.Item {
+		s, err := stringArgs("upper", args, 1, 1)
+		if err != nil {
+			return err
+		}
+		return &Item.String{Value: strings.ToUpper(s[0])}
+	}},
+	"lower": {Fn: func(args ...Item.Item) Item.Item {
+		s, err := stringArgs("lower", args, 1, 1)
+		if err != nil {
+			return err
+		}
+		return &Item.String{Value: strings.ToLower(s[0])}
+	}},
+	"trim": {Fn: func(args ...Item.Item) Item.Item {
+		s, err := stringArgs("trim", args, 1, 2)
+		if err != nil {
+			return err
+		}
+		if len(s) == 1 {
+			return &Item.String{Value: strings.TrimSpace(s[0])}
+		}
+		return &Item.String{Value: strings.Trim(s[0], s[1])}
+	}},
+	"repeat": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) != 2 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=2. Received=%d.", len(args))
+		}
+		s, ok := args[0].(*Item.String)
+		if !ok {
+			return newKindError(Item.TYPE_ERROR, "First argument to `repeat` must be STRING. Received %s", args[0].Type())
+		}
+		count, ok := args[1].(*Item.Integer)
+		if !ok {
+			return newKindError(Item.TYPE_ERROR, "Second argument to `repeat` must be INTEGER. Received %s", args[1].Type())
+		}
+		if count.Value < 0 {
+			return newKindError(Item.VALUE_ERROR, "`repeat` needs a count of at least 0, got %d", count.Value)
+		}
+		if len(s.Value) > 0 && count.Value > maxStringLength/int64(len(s.Value)) {
+			return newKindError(Item.VALUE_ERROR, "`repeat` would make a string longer than %d bytes", maxStringLength)
+		}
+		return &Item.String{Value: strings.Repeat(s.Value, int(count.Value))}
+	}},
+	"substr": {Fn: func(args ...Item.Item) Item.Item {
+		if len(args) < 2 || len(args) > 3 {
+			return newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected 2 or 3. Received=%d.", len(args))
+		}
+		s, ok := args[0].(*Item.String)
+		if !ok {
+			return newKindError(Item.TYPE_ERROR, "First argument to `substr` must be STRING. Received %s", args[0].Type())
+		}
+		bounds := make([]int64, len(args)-1)
+		for i, arg := range args[1:] {
+			integer, ok := arg.(*Item.Integer)
+			if !ok {
+				return newKindError(Item.TYPE_ERROR, "Arguments to `substr` after the string must be INTEGER. Received %s", arg.Type())
+			}
+			bounds[i] = integer.Value
+		}
+		length := int64(len(s.Value))
+		start := bounds[0]
+		if start < 0 || start > length {
+			return newKindError(Item.INDEX_ERROR, "`substr` start %d out of range for string of length %d", start, length)
+		}
+		end := length
+		if len(bounds) == 2 {
+			if bounds[1] < 0 {
+				return newKindError(Item.VALUE_ERROR, "`substr` needs a length of at least 0, got %d", bounds[1])
+			}
+			if bounds[1] < length-start {
+				end = start + bounds[1]
+			}
+		}
+		return &Item.String{Value: s.Value[start:end]}
+	}},
+}
+
+// stringArgs checks that a builtin got between min and max arguments, all of
+// them strings, and returns their values.
+func stringArgs(name string, args []Item.Item, min, max int) ([]string, *Item.Error) {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return nil, newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected=%d. Received=%d.", min, len(args))
+		}
+		return nil, newKindError(Item.ARGUMENT_ERROR, "Wrong number of arguments! Expected %d or %d. Received=%d.", min, max, len(args))
+	}
+	values := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.(*Item.String)
+		if !ok {
+			return nil, newKindError(Item.TYPE_ERROR, "Arguments to `%s` must be STRING. Received %s", name, arg.Type())
+		}
+		values[i] = s.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,164 @@
+// Package sg embeds the SG language in Go programs.
+//
+//	in := sg.New()
+//	in.Set("limit", 10)
+//	in.Register("double", func(x int64) int64 { return 2 * x })
+//	value, err := in.Eval(`limit * 2`)
+package sg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sg_interpreter/src/sg/Item"
+	"sg_interpreter/src/sg/evaluator"
+	"sg_interpreter/src/sg/lexer"
+	"sg_interpreter/src/sg/parser"
+	"sg_interpreter/src/sg/token"
+	"strings"
+)
+
+// Interpreter runs SG programs with the tree-walking evaluator. Variables a
+// program defines stay around for the following calls to Eval, like in the
+// REPL. An Interpreter must not be used by several goroutines at once.
+type Interpreter struct {
+	// Stdout and Stderr receive what puts and eputs print. They default to
+	// the process' standard output and error.
+	Stdout io.Writer
+	Stderr io.Writer
+	// SearchPath lists the directories imported modules are looked for in
+	// when they aren't next to the importing file.
+	SearchPath []string
+
+	host    *Item.Scope // values bound by the host application
+	program *Item.Scope // variables defined by the programs, inside host
+}
+
+func New() *Interpreter {
+	in := &Interpreter{Stdout: os.Stdout, Stderr: os.Stderr, host: Item.NewScope()}
+	in.host.Set("puts", evaluator.Printer(writerFunc(func(p []byte) (int, error) {
+		return in.Stdout.Write(p)
+	})))
+	in.host.Set("eputs", evaluator.Printer(writerFunc(func(p []byte) (int, error) {
+		return in.Stderr.Write(p)
+	})))
+	in.host.Modules = Item.NewModules(in.host, nil)
+	in.program = Item.NewEnclosedScope(in.host)
+	return in
+}
+
+// Set binds a Go value to a global, see ToItem for the values supported.
+// Programs may define a variable of the same name, which then hides it.
+func (in *Interpreter) Set(name string, value interface{}) error {
+	item, err := toItem(name, reflect.ValueOf(value), 0)
+	if err != nil {
+		return err
+	}
+	in.host.Set(name, item)
+	return nil
+}
+
+// Get returns the value of a global as a Go value, see FromItem.
+func (in *Interpreter) Get(name string) (interface{}, bool) {
+	item, ok := in.program.Get(name)
+	if !ok {
+		return nil, false
+	}
+	return FromItem(item), true
+}
+
+// Register makes the Go function fn callable from programs under name.
+// Arguments are converted to the parameter types like Decode does, and
+// calls with the wrong number or type of arguments are runtime errors. A
+// last result of type error is reported as an SG error when it isn't nil,
+// the other results are converted with ToItem: no result gives null and
+// several an array. A function of type Item.BuiltinFunction is called with
+// the SG values as they are.
+func (in *Interpreter) Register(name string, fn interface{}) error {
+	if fn == nil || reflect.TypeOf(fn).Kind() != reflect.Func {
+		return fmt.Errorf("can't register %T as a function", fn)
+	}
+	return in.Set(name, fn)
+}
+
+// Eval runs source and returns the value of its last statement.
+func (in *Interpreter) Eval(source string) (interface{}, error) {
+	return in.eval("", source)
+}
+
+// EvalFile runs the program in the file at path. Error positions name the
+// file.
+func (in *Interpreter) EvalFile(path string) (interface{}, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := filepath.Abs(path); err == nil {
+		// so that a module importing the file is reported as a cycle
+		if cycle, ok := in.host.Modules.Begin(key, path); !ok {
+			return nil, fmt.Errorf("import cycle: %s", cycle)
+		}
+		defer in.host.Modules.End(key, nil)
+	}
+	return in.eval(path, string(source))
+}
+
+func (in *Interpreter) eval(name string, source string) (interface{}, error) {
+	p := parser.New(lexer.NewWithFile(source, name))
+	program := p.ParseProgram()
+	if len(p.ErrorList()) != 0 {
+		return nil, &SyntaxError{Errors: p.ErrorList()}
+	}
+	in.host.Modules.SearchPath = in.SearchPath
+	result := evaluator.Eval(program, in.program)
+	if err, ok := result.(*Item.Error); ok {
+		return nil, newError(err.Value())
+	}
+	return FromItem(result), nil
+}
+
+// SyntaxError is returned for source that can not be parsed.
+type SyntaxError struct {
+	Errors []parser.Error
+}
+
+func (e *SyntaxError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.String()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Error is a runtime error that stopped a program, or an error value.
+type Error struct {
+	Kind    string // like TypeError, see the kinds in package Item
+	Pos     token.Position
+	Message string
+	Trace   []Item.StackFrame // innermost call first
+}
+
+func newError(value *Item.ErrorValue) *Error {
+	return &Error{Kind: value.Kind, Pos: value.Pos, Message: value.Message, Trace: value.Trace}
+}
+
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+	}
+	return e.Message
+}
+
+// Traceback formats the error with the calls it unwound through, the way
+// the sg command prints it.
+func (e *Error) Traceback() string {
+	return (&Item.Error{Kind: e.Kind, Message: e.Message, Pos: e.Pos, Trace: e.Trace}).Traceback()
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
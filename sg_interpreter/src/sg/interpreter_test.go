@@ -0,0 +1,204 @@
+package sg
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sg_interpreter/src/sg/Item"
+	"strings"
+	"testing"
+)
+
+// mustEval runs source and fails the test if it doesn't succeed.
+func mustEval(t *testing.T, in *Interpreter, source string) interface{} {
+	t.Helper()
+	value, err := in.Eval(source)
+	if err != nil {
+		t.Fatalf("%q: %v", source, err)
+	}
+	return value
+}
+
+// runtimeError runs source and returns the *Error it fails with.
+func runtimeError(t *testing.T, in *Interpreter, source string) *Error {
+	t.Helper()
+	value, err := in.Eval(source)
+	var runErr *Error
+	if !errors.As(err, &runErr) {
+		t.Fatalf("%q: got %v, %v, want an *Error", source, value, err)
+	}
+	return runErr
+}
+
+func TestSetAndGet(t *testing.T) {
+	in := New()
+	if err := in.Set("limit", 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustEval(t, in, "limit * 2"); got != int64(20) {
+		t.Errorf("limit * 2 = %#v, want 20", got)
+	}
+	if got, ok := in.Get("limit"); !ok || got != int64(10) {
+		t.Errorf("Get(limit) = %#v, %v, want 10", got, ok)
+	}
+
+	// a variable of the program hides the global of the host
+	mustEval(t, in, "let limit = 3")
+	if got, ok := in.Get("limit"); !ok || got != int64(3) {
+		t.Errorf("Get(limit) after let = %#v, %v, want 3", got, ok)
+	}
+	if err := in.Set("limit", 100); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustEval(t, in, "limit"); got != int64(3) {
+		t.Errorf("limit after Set = %#v, want 3", got)
+	}
+
+	if got, ok := in.Get("missing"); ok {
+		t.Errorf("Get(missing) = %#v, want nothing", got)
+	}
+	if err := in.Set("channel", make(chan int)); err == nil {
+		t.Error("Set of a channel succeeded")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	in := New()
+	if err := in.Register("double", func(x int64) int64 { return 2 * x }); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Register("fail", func() (int, error) { return 0, errors.New("broken") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Register("number", 1); err == nil {
+		t.Error("registering a number succeeded")
+	}
+
+	if got := mustEval(t, in, "double(21)"); got != int64(42) {
+		t.Errorf("double(21) = %#v, want 42", got)
+	}
+	tests := []struct {
+		source  string
+		kind    string
+		message string
+	}{
+		{"double(1, 2)", Item.ARGUMENT_ERROR, "Wrong number of arguments to `double`! Expected=1. Received=2"},
+		{`double("a")`, Item.TYPE_ERROR, "Argument 1 to `double`: can't use STRING as int64"},
+		{"fail()", Item.GENERIC_ERROR, "broken"},
+	}
+	for _, tt := range tests {
+		err := runtimeError(t, in, tt.source)
+		if err.Kind != tt.kind || err.Message != tt.message {
+			t.Errorf("%q: got %s %q, want %s %q", tt.source, err.Kind, err.Message, tt.kind, tt.message)
+		}
+	}
+	if got := mustEval(t, in, "let caught = \"\"\ntry { fail() } catch (e) { caught = e.message }\ncaught"); got != "broken" {
+		t.Errorf("caught %#v, want the error of fail", got)
+	}
+}
+
+func TestEvalKeepsState(t *testing.T) {
+	in := New()
+	mustEval(t, in, "let n = 1\nfun next() { n += 1; n }")
+	mustEval(t, in, "next()")
+	if got := mustEval(t, in, "next()"); got != int64(3) {
+		t.Errorf("next() = %#v, want 3", got)
+	}
+	// a failed program keeps what it defined before failing
+	runtimeError(t, in, "let m = 5\nnext(1)")
+	if got := mustEval(t, in, "m + n"); got != int64(8) {
+		t.Errorf("m + n = %#v, want 8", got)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	in := New()
+	_, err := in.Eval("let = 1")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || len(syntaxErr.Errors) == 0 {
+		t.Fatalf("got %v, want a *SyntaxError", err)
+	}
+	if first := syntaxErr.Errors[0]; first.Pos.Line != 1 || !strings.Contains(err.Error(), first.String()) {
+		t.Errorf("got %v, want it to list %v on line 1", err, first)
+	}
+
+	runErr := runtimeError(t, in, "let f = fun() { 1 + \"a\" }\nf()")
+	if runErr.Kind != Item.TYPE_ERROR || runErr.Pos.Line != 1 || runErr.Pos.Column != 19 {
+		t.Errorf("got %s at %v, want a TypeError at 1:19", runErr.Kind, runErr.Pos)
+	}
+	if want := "1:19: type mismatch: INTEGER + STRING"; runErr.Error() != want {
+		t.Errorf("Error() = %q, want %q", runErr.Error(), want)
+	}
+	wantTrace := []Item.StackFrame{{Function: "f", CallPos: runErr.Trace[0].CallPos}}
+	if !reflect.DeepEqual(runErr.Trace, wantTrace) || runErr.Trace[0].CallPos.Line != 2 {
+		t.Errorf("trace %v, want f called on line 2", runErr.Trace)
+	}
+	if want := "ERROR: 1:19: type mismatch: INTEGER + STRING\nTraceback (most recent call first):\n  in f, called at 2:1"; runErr.Traceback() != want {
+		t.Errorf("Traceback() = %q, want %q", runErr.Traceback(), want)
+	}
+}
+
+func TestEvalFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, source string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	in := New()
+	in.Stdout = &bytes.Buffer{}
+
+	bad := write("bad.sg", "puts(1)\nlet x = 1 + \"a\"")
+	_, err := in.EvalFile(bad)
+	var runErr *Error
+	if !errors.As(err, &runErr) || runErr.Pos.File != bad || runErr.Pos.Line != 2 {
+		t.Errorf("got %v, want an error on line 2 of %s", err, bad)
+	}
+	if !strings.HasPrefix(err.Error(), bad+":2:") {
+		t.Errorf("Error() = %q, want it to name %s", err.Error(), bad)
+	}
+
+	main := write("main.sg", "import lib")
+	lib := write("lib.sg", "import main")
+	for i := 0; i < 2; i++ {
+		// the second time shows the file is no longer taken as being run
+		_, err = in.EvalFile(main)
+		if !errors.As(err, &runErr) || runErr.Kind != Item.IMPORT_ERROR {
+			t.Fatalf("got %v, want an ImportError", err)
+		}
+		if want := "import cycle: " + main + " -> " + lib + " -> " + main; runErr.Message != want {
+			t.Errorf("got %q, want %q", runErr.Message, want)
+		}
+	}
+
+	if _, err := in.EvalFile(filepath.Join(dir, "missing.sg")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v, want a missing file", err)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "loud.sg"), []byte(`puts("module")`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	in := New()
+	in.Stdout, in.Stderr = &stdout, &stderr
+	in.SearchPath = []string{dir}
+	mustEval(t, in, "puts(\"out\", 1)\neputs(\"err\")\nimport loud")
+	if stdout.String() != "out 1\nmodule\n" || stderr.String() != "err\n" {
+		t.Errorf("got stdout %q and stderr %q", stdout.String(), stderr.String())
+	}
+
+	// the writers are looked up on every call, not when the interpreter is made
+	var later bytes.Buffer
+	in.Stdout = &later
+	mustEval(t, in, `puts("later")`)
+	if later.String() != "later\n" || stdout.String() != "out 1\nmodule\n" {
+		t.Errorf("got %q after changing Stdout", later.String())
+	}
+}
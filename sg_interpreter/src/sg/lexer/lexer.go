@@ -7,10 +7,18 @@ type Lexer struct {
 	pos   int  //current pos
 	nxt   int  //next pos
 	ch    byte //cur char
+
+	file string
+	line int //line of cur char
+	col  int //column of cur char
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFile(input, "")
+}
+
+func NewWithFile(input string, file string) *Lexer {
+	l := &Lexer{input: input, file: file, line: 1}
 	l.readChar()
 	return l
 }
@@ -18,6 +26,7 @@ func New(input string) *Lexer {
 func (l *Lexer) NextToken() token.Token {
 	l.skipWhitespace()
 	var tok token.Token
+	pos := token.Position{File: l.file, Line: l.line, Column: l.col}
 
 	switch l.ch {
 	case '=':
@@ -30,17 +39,45 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.SET, l.ch)
 		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.withAssign(token.MINUS, token.MINUS_SET)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.withAssign(token.PLUS, token.PLUS_SET)
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		tok = l.withAssign(token.SLASH, token.SLASH_SET)
 	case '*':
-		tok = newToken(token.STAR, l.ch)
+		tok = l.withAssign(token.STAR, token.STAR_SET)
+	case '%':
+		tok = l.withAssign(token.MOD, token.MOD_SET)
+	case '^':
+		tok = l.withAssign(token.BIT_XOR, token.BIT_XOR_SET)
+	case '~':
+		tok = newToken(token.BIT_NOT, l.ch)
+	case '&':
+		if l.peek() == '&' {
+			tok = l.newOperator(token.AND)
+		} else {
+			tok = l.withAssign(token.BIT_AND, token.BIT_AND_SET)
+		}
+	case '|':
+		if l.peek() == '|' {
+			tok = l.newOperator(token.OR)
+		} else {
+			tok = l.withAssign(token.BIT_OR, token.BIT_OR_SET)
+		}
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peek() == '<' {
+			l.readChar()
+			tok = l.withAssign(token.SHL, token.SHL_SET)
+		} else {
+			tok = l.withAssign(token.LT, token.LT_EQ)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peek() == '>' {
+			l.readChar()
+			tok = l.withAssign(token.SHR, token.SHR_SET)
+		} else {
+			tok = l.withAssign(token.GT, token.GT_EQ)
+		}
 	case '(':
 		tok = newToken(token.LP, l.ch)
 	case ')':
@@ -68,6 +105,17 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RBP, l.ch)
 	case ':':
 		tok = newToken(token.COL, l.ch)
+	case '.':
+		if isDigit(l.peek()) {
+			tok.Type, tok.Literal = l.readNum()
+			tok.Pos = pos
+			return tok
+		}
+		if l.peek() == '.' && l.nxt+1 < len(l.input) && l.input[l.nxt+1] == '.' {
+			tok = l.newOperator(token.REST)
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case '"':
 		tok.Type = token.STRING
 		tok.Literal = l.readString()
@@ -78,16 +126,18 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdent()
 			tok.Type = token.FindIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNum()
+			tok.Type, tok.Literal = l.readNum()
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
@@ -98,6 +148,12 @@ func (l *Lexer) skipWhitespace() {
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
 	if l.nxt >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -126,12 +182,38 @@ func (l *Lexer) peek() byte {
 	}
 }
 
-func (l *Lexer) readNum() string {
+// readNum reads an integer, or a float when a fraction (`3.14`, `.5`) or an
+// exponent (`1e-9`) follows the digits.
+func (l *Lexer) readNum() (token.TokenType, string) {
 	position := l.pos
+	tokenType := token.TokenType(token.INT)
+	l.readDigits()
+	if l.ch == '.' && isDigit(l.peek()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peek()
+		if (next == '+' || next == '-') && l.nxt+1 < len(l.input) {
+			next = l.input[l.nxt+1]
+		}
+		if isDigit(next) {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+	return tokenType, l.input[position:l.pos]
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.pos]
 }
 
 func (l *Lexer) readIdent() string {
@@ -151,6 +233,25 @@ func isDigit(ch byte) bool {
 	return ch >= '0' && ch <= '9'
 }
 
+// withAssign returns the operator that continues with '=' if the next
+// character is one, like `+=` or `<=`, and plain otherwise.
+func (l *Lexer) withAssign(plain token.TokenType, assign token.TokenType) token.Token {
+	if l.peek() == '=' {
+		l.readChar()
+		return token.Token{Type: assign, Literal: string(assign)}
+	}
+	return token.Token{Type: plain, Literal: string(plain)}
+}
+
+// newOperator consumes the rest of a multi-character operator whose
+// literal is its token type. The last character is left for NextToken.
+func (l *Lexer) newOperator(tokenType token.TokenType) token.Token {
+	for i := 1; i < len(tokenType); i++ {
+		l.readChar()
+	}
+	return token.Token{Type: tokenType, Literal: string(tokenType)}
+}
+
 func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+// expressionTest is an expression and what puts prints for it, or for the
+// error it raises, as "kind: message".
+type expressionTest struct {
+	expression string
+	want       string
+}
+
+func checkExpressions(t *testing.T, tests []expressionTest, flags ...string) {
+	t.Helper()
+	programs := make([]programTest, len(tests))
+	for i, tt := range tests {
+		programs[i] = programTest{
+			name:   tt.expression,
+			source: "try { puts(" + tt.expression + ") } catch (e) { puts(e.type + \": \" + e.message) }",
+			out:    tt.want,
+		}
+	}
+	checkPrograms(t, programs, flags...)
+}
+
+func TestDivisionByZero(t *testing.T) {
+	tests := []expressionTest{
+		{"1 / 0", "ZeroDivisionError: division by zero"},
+		{"0 / 0", "ZeroDivisionError: division by zero"},
+		{"-7 / 0", "ZeroDivisionError: division by zero"},
+		{"1 % 0", "ZeroDivisionError: modulo by zero"},
+		{"-7 % 0", "ZeroDivisionError: modulo by zero"},
+		{"9223372036854775808 / 0", "ZeroDivisionError: division by zero"},
+		{"9223372036854775808 % 0", "ZeroDivisionError: modulo by zero"},
+		{"fun() { let x = 5; x /= 0 }()", "ZeroDivisionError: division by zero"},
+		{"fun() { let x = 5; x %= 0 }()", "ZeroDivisionError: modulo by zero"},
+		{"powmod(2, 10, 0)", "ZeroDivisionError: modulo by zero"},
+		// floats follow the floating-point rules instead
+		{"1.0 / 0", "+Inf"},
+		{"-1 / 0.0", "-Inf"},
+		{"1.0 % 0", "NaN"},
+		{"5 % 0.0", "NaN"},
+		// the one division that overflows promotes like the other operators
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) % -1", "0"},
+	}
+	checkExpressions(t, tests)
+	t.Run("checked", func(t *testing.T) {
+		checkExpressions(t, tests[:len(tests)-2], "-checked")
+	})
+}
+
+func TestCheckedOverflow(t *testing.T) {
+	tests := []struct {
+		expression string
+		unchecked  string // the result when integers are promoted
+		checked    string // the result with -checked
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808", "OverflowError: integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "-9223372036854775809", "OverflowError: integer overflow: -9223372036854775807 - 2"},
+		{"4611686018427387904 * 2", "9223372036854775808", "OverflowError: integer overflow: 4611686018427387904 * 2"},
+		{"3037000500 * 3037000500", "9223372037000250000", "OverflowError: integer overflow: 3037000500 * 3037000500"},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808", "OverflowError: integer overflow: -9223372036854775808 / -1"},
+		{"1 << 63", "9223372036854775808", "OverflowError: integer overflow: 1 << 63"},
+		{"1 << 64", "18446744073709551616", "OverflowError: integer overflow: 1 << 64"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808", "OverflowError: integer overflow: -(-9223372036854775808)"},
+		{"pow(2, 63)", "9223372036854775808", "OverflowError: integer overflow: pow(2, 63)"},
+		{"fun() { let x = 9223372036854775807; x += 1; x }()", "9223372036854775808", "OverflowError: integer overflow: 9223372036854775807 + 1"},
+		// results that fit are the same either way
+		{"9223372036854775807 - 1 + 1", "9223372036854775807", "9223372036854775807"},
+		{"-9223372036854775807 - 1", "-9223372036854775808", "-9223372036854775808"},
+		{"1 << 62", "4611686018427387904", "4611686018427387904"},
+		{"pow(2, 62)", "4611686018427387904", "4611686018427387904"},
+		{"pow(-2, 63)", "-9223372036854775808", "-9223372036854775808"},
+		{"(-9223372036854775807 - 1) % -1", "0", "0"},
+	}
+	unchecked := make([]expressionTest, len(tests))
+	checked := make([]expressionTest, len(tests))
+	for i, tt := range tests {
+		unchecked[i] = expressionTest{tt.expression, tt.unchecked}
+		checked[i] = expressionTest{tt.expression, tt.checked}
+	}
+	t.Run("unchecked", func(t *testing.T) { checkExpressions(t, unchecked) })
+	t.Run("checked", func(t *testing.T) { checkExpressions(t, checked, "-checked") })
+}
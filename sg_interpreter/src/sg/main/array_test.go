@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestArraySlices(t *testing.T) {
+	checkExpressions(t, []expressionTest{
+		{"[1, 2, 3, 4, 5][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4, 5][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4, 5][3:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][-2:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][4:2]", "[]"},
+		{"[1, 2, 3, 4, 5][1:99]", "[2, 3, 4, 5]"},
+		{"[1, 2][\"a\":1]", "TypeError: slice bounds must be INTEGER, not STRING"},
+		{"[1] + [2, 3]", "[1, 2, 3]"},
+		{"[1] + 1", "TypeError: type mismatch: ARRAY + INTEGER"},
+	})
+}
+
+func TestArrayBuiltins(t *testing.T) {
+	checkExpressions(t, []expressionTest{
+		{"pop([1, 2, 3])", "3"},
+		{"insert([1, 2], 0, 0)", "[0, 1, 2]"},
+		{"insert([1, 2], 2, 3)", "[1, 2, 3]"},
+		{"remove_at([1, 2, 3], 1)", "2"},
+		{"fill([1, 2], 7)", "[7, 7]"},
+		{"concat([1], [2], [3, 4])", "[1, 2, 3, 4]"},
+		{"make(3, \"x\")", "[x, x, x]"},
+		{"make(0, 1)", "[]"},
+		{"pop([])", "IndexError: `pop` from an empty array"},
+		{"insert([1], 3, 0)", "IndexError: `insert` index 3 out of range for array of length 1"},
+		{"remove_at([1], 1)", "IndexError: `remove_at` index 1 out of range for array of length 1"},
+		{"make(-1, 0)", "ValueError: `make` needs a count of at least 0, got -1"},
+	})
+}
+
+func TestArrayCopies(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"slices copy", "let a = [1, 2, 3]\nlet s = a[0:2]\ns[0] = 100\nputs(a, s)", "[1, 2, 3] [100, 2]", ""},
+		{"+ copies", "let b = [1, 2]\nlet c = b + [3]\npush(c, 4)\nputs(b, c)", "[1, 2] [1, 2, 3, 4]", ""},
+		{"copy copies", "let p = [1]\nlet q = copy(p)\npush(q, 2)\nputs(p, q, copy(p) == p)", "[1] [1, 2] true", ""},
+		{"pop, insert and remove_at change the array", `
+let p = [1, 2, 3]
+pop(p)
+insert(p, 1, 9)
+remove_at(p, 0)
+puts(p)`, "[9, 2]", ""},
+		{"make shares its value", "let shared = make(2, [])\npush(shared[0], 1)\nputs(shared)", "[[1], [1]]", ""},
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestBigIntegers(t *testing.T) {
+	checkExpressions(t, []expressionTest{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 1 - 1", "-9223372036854775809"},
+		{"pow(2, 100)", "1267650600228229401496703205376"},
+		{"pow(2, 100) / pow(2, 99)", "2"},
+		{"pow(2, 100) % 7", "2"},
+		{"-pow(2, 100) / 3", "-422550200076076467165567735125"},
+		{"-pow(2, 100) % 3", "-1"},
+		{"pow(2, 64) - pow(2, 64) + 1", "1"},
+		{"pow(2, 64) > 9223372036854775807", "true"},
+		{"pow(2, 64) == 18446744073709551616", "true"},
+		{"pow(2, 64) < 1e30", "true"},
+		{"pow(2, 64) + 0.5", "18446744073709552000.0"},
+		{"pow(2, 64) >> 60", "16"},
+		{"pow(2, 64) | 1", "18446744073709551617"},
+		{"pow(2, 64) & pow(2, 64)", "18446744073709551616"},
+		{"~pow(2, 64)", "-18446744073709551617"},
+		{"1 << 100", "1267650600228229401496703205376"},
+		{"powmod(3, pow(2, 70), 1000000007)", "892517638"},
+		{"{pow(2, 64): \"big\"}[18446744073709551616]", "big"},
+		{"int(\"123456789012345678901234567890\")", "123456789012345678901234567890"},
+		{"float(pow(2, 64))", "18446744073709552000.0"},
+	})
+}
+
+func TestBigIntegerPrograms(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"factorial", `
+let fact = fun(n) { if (n < 2) { return 1 }; n * fact(n - 1) }
+puts(fact(30))`, "265252859812191058636308480000000", ""},
+		{"fibonacci", `
+let a = 0
+let b = 1
+for (i in range(200)) { let c = a + b; a = b; b = c }
+puts(a)`, "280571172992510140037611932413038677189525", ""},
+	})
+}
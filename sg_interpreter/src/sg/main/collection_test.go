@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestCollectionBuiltins(t *testing.T) {
+	checkExpressions(t, []expressionTest{
+		{"map([1, 2, 3], fun(x) { x * x })", "[1, 4, 9]"},
+		{"map(\"abc\", fun(c) { upper(c) })", "[A, B, C]"},
+		{"map({\"k\": 1, \"j\": 2}, fun(k) { k })", "[k, j]"},
+		{"filter(range(6), fun(x) { x % 2 == 0 })", "[0, 2, 4]"},
+		{"reduce([1, 2, 3], fun(a, x) { a + x })", "6"},
+		{"reduce([], fun(a, x) { a + x }, 10)", "10"},
+		{"[any([]), all([]), any([0, false, 3])]", "[false, true, true]"},
+		{"all([1, 2], fun(x) { x > 1 })", "false"},
+		{"any(range(3), fun(x) { x == 2 })", "true"},
+		{"find([1, 5, 8], fun(x) { x > 4 })", "5"},
+		{"find([1], fun(x) { false })", "null"},
+		{"flat_map([1, 2], fun(x) { [x, x * 10] })", "[1, 10, 2, 20]"},
+		{"min_by([\"ccc\", \"a\", \"bb\", \"z\"], fun(s) { len(s) })", "a"},
+		{"max_by([\"ccc\", \"a\", \"ddd\"], fun(s) { len(s) })", "ccc"},
+		{"min_by([], fun(x) { x })", "null"},
+		{"zip([1, 2, 3], [\"a\", \"b\"], [true, false, true])", "[[1, a, true], [2, b, false]]"},
+		{"enumerate([\"x\", \"y\"])", "[[0, x], [1, y]]"},
+		{"reduce([], fun(a, x) { a + x })", "ValueError: `reduce` of nothing needs an initial value"},
+		{"flat_map([1], fun(x) { x })", "TypeError: the function given to `flat_map` must return ARRAY, not INTEGER"},
+		{"filter(1, fun(x) { x })", "TypeError: Argument to `filter` must be iterable. Received INTEGER"},
+	})
+}
+
+func TestCollectionCallbacks(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"any stops at the answer", `
+let seen = []
+puts(any([1, 2, 3, 4], fun(x) { push(seen, x); x == 2 }), seen)`, "true [1, 2]", ""},
+		{"errors stop the builtin", "map([1, 2], fun(x) { x + \"s\" })",
+			"", "ERROR: main.sg:1:24: type mismatch: INTEGER + STRING\nTraceback (most recent call first):\n  in <anonymous>, called at main.sg:1:1"},
+		{"callback with too many parameters", "map([1], fun(a, b) { a })",
+			"", "ERROR: main.sg:1:1: wrong number of arguments: want=2, got=1"},
+	})
+}
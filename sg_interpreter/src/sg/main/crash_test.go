@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestValuesThatContainThemselves(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"array", "let a = []\npush(a, a)\nputs(a)", "[[...]]", ""},
+		{"hash", "let h = {}\nh[\"x\"] = h\nputs(h)", "{x: {...}}", ""},
+		{"sorted", "let a = []\npush(a, a)\nputs(sort([a, a]))", "[[[...]], [[...]]]", ""},
+		{"through each other", "let a = [1]\nlet h = {\"a\": a}\npush(a, h)\nputs(a, h)", "[1, {a: [...]}] {a: [1, {...}]}", ""},
+		{"shared but not cyclic", "let s = [1]\nputs([s, s], {\"x\": s, \"y\": s})", "[[1], [1]] {x: [1], y: [1]}", ""},
+		{"compared", "let p = []\npush(p, p)\npush(p, 1)\nlet q = []\npush(q, q)\npush(q, 2)\nputs(p < q, q < p, p == q, p == p)", "true false false true", ""},
+		{"as a key", "let a = []\npush(a, a)\nlet h = {}\nh[a] = 1", "", "ERROR: main.sg:4:1: unusable as hash key: ARRAY"},
+	})
+}
+
+// nested is a program that makes name an array nested depth levels deep. It
+// builds it in a loop, so running it needs no deep Go stack.
+func nested(name string, depth int) string {
+	return fmt.Sprintf("let %[1]s = []\nif (true) {\n  let i = 0\n  while (i < %[2]d) { %[1]s = [%[1]s]; i += 1 }\n}\n", name, depth)
+}
+
+// smallStack lowers how much stack a goroutine may use until the test ends,
+// so that following a value nested deeper than the stack allows crashes
+// without first taking gigabytes.
+func smallStack(t *testing.T) {
+	old := debug.SetMaxStack(16 << 20)
+	t.Cleanup(func() { debug.SetMaxStack(old) })
+}
+
+func TestDeeplyNestedValues(t *testing.T) {
+	smallStack(t)
+	deep := nested("a", 150000)
+	printed := func(levels int) string {
+		return strings.Repeat("[", levels) + "[...]" + strings.Repeat("]", levels)
+	}
+	checkPrograms(t, []programTest{
+		{"printed", deep + "puts(a)", printed(16384), ""},
+		{"in a hash", deep + "puts({\"a\": a})", "{a: " + printed(16383) + "}", ""},
+		{"as a key", deep + "let h = {}\nh[a] = 1",
+			"", "ERROR: main.sg:7:1: hash key nested more than 16384 levels deep"},
+		{"caught", deep + "try { has({}, a) } catch (e) { puts(e.type) }", "RecursionError", ""},
+	})
+}
+
+func TestRunawayPrograms(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"wrong number of arguments", "let f = fun(a, b) { a }\nf(1)", "", "ERROR: main.sg:2:1: wrong number of arguments: want=2, got=1"},
+		{"calling null", "let h = {}\nh[\"missing\"]()", "", "ERROR: main.sg:2:2: not a function: NULL"},
+		{"printing a function with an if", "puts(fun(x) { if (x) { 1 } })", "fun(x) {\nif (x) 1\n}", ""},
+	})
+
+	// only the first lines of a traceback this deep are compared
+	got := runBoth(t, map[string]string{"main.sg": "let f = fun(n) { f(n + 1) }\nf(0)"})
+	first, _, _ := strings.Cut(got.stderr, "\n")
+	if want := "ERROR: main.sg:1:18: stack overflow: more than 16384 nested calls"; first != want || got.code != exitRuntimeError {
+		t.Errorf("got %+v, want %q", got, want)
+	}
+
+	got = runBoth(t, map[string]string{"main.sg": "puts(" + strings.Repeat("[", 6000) + strings.Repeat("]", 6000) + ")"})
+	if got.code != exitParseError || !strings.Contains(got.stderr, "nested") {
+		t.Errorf("got %+v, want a parse error about nesting", got)
+	}
+}
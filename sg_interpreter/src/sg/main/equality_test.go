@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestStructuralEquality(t *testing.T) {
+	checkExpressions(t, []expressionTest{
+		{"[1, 2] == [1, 2]", "true"},
+		{"[1, [2]] == [1, [2]]", "true"},
+		{"[1] == [1, 2]", "false"},
+		{"[1] != [2]", "true"},
+		{"{\"a\": 1, \"b\": 2} == {\"b\": 2, \"a\": 1}", "true"},
+		{"{\"a\": 1} == {\"a\": 2}", "false"},
+		{"[1 == \"1\", [1] == 1, {} == []]", "[false, false, false]"},
+		{"[1 == 1.0, 0.0 == -0.0, [1] == [1.0]]", "[true, true, true]"},
+		{"9223372036854775808 == 9223372036854775808.0", "true"},
+	})
+}
+
+func TestOrdering(t *testing.T) {
+	checkExpressions(t, []expressionTest{
+		{"[1, 2] < [1, 3]", "true"},
+		{"[1] < [1, 0]", "true"},
+		{"[2] > [1, 9]", "true"},
+		{"[] <= []", "true"},
+		{"[1] < [\"a\"]", "TypeError: type mismatch: INTEGER < STRING"},
+		{"{} < {}", "TypeError: unknown operator: HASH < HASH"},
+	})
+}
+
+func TestKeys(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"equal numbers are the same key", `
+let h = {}
+h[1] = "int"
+h[1.0] = "float"
+h[[1]] = "array"
+h[[1.0]] = "float array"
+h[-0.0] = "zero"
+puts(h, len(h), h[0])`, "{1: float, [1]: float array, -0.0: zero} 3 zero", ""},
+		{"big integers and floats", "let k = {9223372036854775808: \"big\"}\nputs(k[9223372036854775808.0], k[pow(2, 63)])", "big big", ""},
+		{"array keys", "let t = {[1, \"x\"]: 1, [1, \"y\"]: 2}\nputs(t[[1, \"x\"]], t[[1, \"y\"]], t[[1, \"z\"]])", "1 2 null", ""},
+		{"array keys are copied", "let key = [1]\nlet h = {key: 1}\npush(key, 2)\nputs(h, h[[1]])", "{[1]: 1} 1", ""},
+		{"NaN", "let h = {}\nh[0.0 / 0.0] = 1", "", "ERROR: main.sg:2:1: unusable as hash key: FLOAT"},
+	})
+}
+
+func TestDeeplyNestedComparisons(t *testing.T) {
+	smallStack(t)
+	deep := nested("a", 150000) + nested("b", 150000)
+	tooDeep := "RecursionError: values nested more than 16384 levels deep can't be compared"
+	checkPrograms(t, []programTest{
+		{"equal", deep + "try { puts(a == b) } catch (e) { puts(e.type + \": \" + e.message) }", tooDeep, ""},
+		{"ordered", deep + "try { puts(a < b) } catch (e) { puts(e.type + \": \" + e.message) }", tooDeep, ""},
+		{"in hashes", deep + "try { puts({\"x\": a} != {\"x\": b}) } catch (e) { puts(e.type + \": \" + e.message) }", tooDeep, ""},
+		{"searched for", deep + "try { puts(contains([a], b)) } catch (e) { puts(e.type + \": \" + e.message) }", tooDeep, ""},
+		{"uncaught", deep + "puts(a == b)", "", "ERROR: main.sg:11:8: " + tooDeep[len("RecursionError: "):]},
+		{"the same array", deep + "puts(a == a)", "true", ""},
+	})
+	checkPrograms(t, []programTest{
+		{"just within the limit", nested("c", 16000) + nested("d", 16000) + "puts(c == d, c <= d)", "true true", ""},
+	})
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestFloats(t *testing.T) {
+	checkExpressions(t, []expressionTest{
+		{"1 + 0.5", "1.5"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+		{"7 / 2.0", "3.5"},
+		{"7 / 2", "3"},
+		{"2.0 * 3", "6.0"},
+		{"-.5", "-0.5"},
+		{"1e-9", "1e-09"},
+		{"1e21", "1e+21"},
+		{"123456789.0 * 1000000000000", "123456789000000000000.0"},
+		{"1 == 1.0", "true"},
+		{"2 < 2.5", "true"},
+		{"9007199254740993 == 9007199254740992.0", "false"},
+		{"9223372036854775808 > 1.0", "true"},
+		{"7.5 % 2", "1.5"},
+		{"sqrt(2)", "1.4142135623730951"},
+		{"floor(-1.5)", "-2.0"},
+		{"ceil(1.2)", "2.0"},
+		{"abs(-3.0)", "3.0"},
+		{"int(3.9)", "3"},
+		{"float(3)", "3.0"},
+		{"pow(2, 0.5)", "1.4142135623730951"},
+		{"pow(2.0, 3)", "8.0"},
+		{"0.0 / 0.0 == 0.0 / 0.0", "false"},
+		{"-0.0", "-0.0"},
+		{"1.5 & 1", "TypeError: unknown operator: FLOAT & INTEGER"},
+	})
+}
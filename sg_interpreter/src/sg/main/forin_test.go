@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestForInLoops(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"array", "for (x in [1, 2, 3]) { puts(x) }", "1\n2\n3", ""},
+		{"array with index", "for (i, x in [\"a\", \"b\"]) { puts(i, x) }", "0 a\n1 b", ""},
+		{"string", "for (c in \"hey\") { puts(c) }", "h\ne\ny", ""},
+		{"string with index", "for (i, c in \"ab\") { puts(i, c) }", "0 a\n1 b", ""},
+		{"string of several byte characters", "let n = 0\nlet s = \"\"\nfor (i, c in \"aé\") { n = i; s = s + c }\nputs(n, len(s), s)", "2 3 aé", ""},
+		{"hash keys in order", "for (k in {\"b\": 1, \"a\": 2}) { puts(k) }", "b\na", ""},
+		{"hash keys and values", "for (k, v in {\"b\": 1, \"a\": 2}) { puts(k, v) }", "b 1\na 2", ""},
+		{"range", "for (x in range(3)) { puts(x) }", "0\n1\n2", ""},
+		{"range with step", "for (x in range(10, 0, -4)) { puts(x) }", "10\n6\n2", ""},
+		{"range with index", "for (i, x in range(5, 7)) { puts(i, x) }", "0 5\n1 6", ""},
+		{"empty", "for (x in []) { puts(x) }\nfor (x in \"\") { puts(x) }\nfor (x in {}) { puts(x) }\nputs(\"done\")", "done", ""},
+		{"break and continue", "for (x in range(10)) { if (x == 1) { continue }; if (x == 3) { break }; puts(x) }", "0\n2", ""},
+		{"sees elements changed ahead of it", "let a = [1, 2]\nfor (x in a) { if (x == 1) { a[1] = 5 }; puts(x) }", "1\n5", ""},
+		{"nested", "for (x in [1, 2]) { for (y in \"ab\") { puts(x, y) } }", "1 a\n1 b\n2 a\n2 b", ""},
+		{"semicolon after the loop", "for (x in [1]) { puts(x) }; puts(2)", "1\n2", ""},
+		{"not iterable", "for (x in 5) {}", "", "ERROR: main.sg:1:1: cannot iterate over INTEGER"},
+		{"return from inside", "let first = fun(a) { for (x in a) { return x } }\nputs(first([7, 8]))", "7", ""},
+	})
+}
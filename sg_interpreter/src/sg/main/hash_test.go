@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestHashBuiltins(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"in insertion order", `
+let h = {"b": 1, "a": 2}
+h["c"] = 3
+puts(keys(h), values(h), items(h), len(h))`, "[b, a, c] [1, 2, 3] [[b, 1], [a, 2], [c, 3]] 3", ""},
+		{"has", "puts(has({\"a\": 1}, \"a\"), has({\"a\": 1}, \"z\"), has({[1]: 2}, [1]))", "true false true", ""},
+		{"a deleted key comes back at the end", `
+let h = {"b": 1, "a": 2, "c": 3}
+delete(h, "b")
+delete(h, "missing")
+puts(h)
+h["b"] = 9
+puts(h)`, "{a: 2, c: 3}\n{a: 2, c: 3, b: 9}", ""},
+		{"merge", `
+let first = {"x": 1, "y": 2}
+puts(merge(first, {"y": 20, "z": 30}), first)`, "{x: 1, y: 20, z: 30} {x: 1, y: 2}", ""},
+		{"loops", `
+for (k, v in {"q": 1, "p": 2}) { puts(k, v) }
+for (k in {"q": 1, "p": 2}) { puts(k) }`, "q 1\np 2\nq\np", ""},
+	})
+}
+
+func TestHashBuiltinErrors(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"not a hash", "puts(keys([1]))",
+			"", "ERROR: main.sg:1:6: Argument to `keys` must be HASH. Received ARRAY"},
+		{"merge with something else", "puts(merge({}, 1))",
+			"", "ERROR: main.sg:1:6: Arguments to `merge` must be HASH. Received INTEGER"},
+		{"unusable key", "delete({}, fun() { 1 })",
+			"", "ERROR: main.sg:1:1: unusable as hash key: FUNCTION"},
+	})
+}
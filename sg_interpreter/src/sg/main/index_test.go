@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestIndexAssignment(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"array element", "let a = [1, 2, 3]\na[0] = 10\nputs(a)", "[10, 2, 3]", ""},
+		{"nested", "let dp = [[0, 0], [0, 0]]\ndp[1][0] = 5\ndp[1][1] += 2\nputs(dp)", "[[0, 0], [5, 2]]", ""},
+		{"hash keys are added or replaced", "let h = {\"a\": 1}\nh[\"b\"] = 2\nh[\"a\"] = 3\nputs(h)", "{a: 3, b: 2}", ""},
+		{"hashes and arrays mixed", `
+let m = {"in": {"x": [0]}}
+m["in"]["x"][0] = "deep"
+m["in"]["y"] = true
+puts(m)`, "{in: {x: [deep], y: true}}", ""},
+		{"array key", "let h = {}\nh[[1, 2]] = \"tuple\"\nputs(h[[1, 2]])", "tuple", ""},
+		{"computed index", "let a = [1, 2]\nlet i = 0\na[i + 1] = \"x\"\nputs(a)", "[1, x]", ""},
+		{"compound", "let c = [1]\nc[0] *= 7\nputs(c[0])", "7", ""},
+	})
+}
+
+func TestIndexAssignmentErrors(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"past the end", "let a = [1]\na[1] = 2",
+			"", "ERROR: main.sg:2:1: index 1 out of range for array of length 1"},
+		{"negative", "let a = [1]\na[-1] = 2",
+			"", "ERROR: main.sg:2:1: index -1 out of range for array of length 1"},
+		{"string", "let s = \"abc\"\ns[0] = \"x\"",
+			"", "ERROR: main.sg:2:1: index assignment not supported: STRING"},
+		{"array with a string index", "let a = [1]\na[\"x\"] = 2",
+			"", "ERROR: main.sg:2:1: array index must be INTEGER, not STRING"},
+		{"function as a key", "let h = {}\nh[fun() { 1 }] = 1",
+			"", "ERROR: main.sg:2:1: unusable as hash key: FUNCTION"},
+		{"compound on a missing key", "let h = {}\nh[\"n\"] += 1",
+			"", "ERROR: main.sg:2:1: type mismatch: NULL + INTEGER"},
+	})
+}
@@ -1,21 +1,185 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sg_interpreter/src/sg/Item"
+	"sg_interpreter/src/sg/compiler"
+	"sg_interpreter/src/sg/evaluator"
+	"sg_interpreter/src/sg/lexer"
+	"sg_interpreter/src/sg/parser"
 	"sg_interpreter/src/sg/repl"
+	"sg_interpreter/src/sg/vm"
+	"strings"
 )
 
+const (
+	exitOK           = 0
+	exitRuntimeError = 1 // the program stopped with an uncaught error
+	exitUsage        = 2 // bad command line
+	exitParseError   = 3 // the program could not be parsed or compiled
+	exitIOError      = 4 // the program could not be read
+)
+
+const usage = `Usage:
+  sg                          start the interactive REPL
+  sg run file.sg [args...]    run a program
+  sg file.sg [args...]        same as sg run
+  sg -e 'program' [args...]   run the given program text and print its value
+  sg - [args...]              read the program from stdin
+
+Options:
+`
+
 func main() {
-	// Open the input file
-	file, err := os.Open(`/Users/slavicg/work/StarGust/sg/sg_interpreter/src/sg/main/input.sg`)
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(arguments []string) int {
+	flags := flag.NewFlagSet("sg", flag.ContinueOnError)
+	engine := flags.String("engine", "eval", "backend used to run the program: eval or vm")
+	program := flags.String("e", "", "program text to run instead of a file")
+	flags.BoolVar(&evaluator.CheckedArithmetic, "checked", false, "report integer overflow as an error instead of promoting to a big integer")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(arguments); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *engine != "eval" && *engine != "vm" {
+		fmt.Fprintf(os.Stderr, "unknown engine %q, expected eval or vm\n", *engine)
+		return exitUsage
+	}
+
+	inline := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "e" {
+			inline = true
+		}
+	})
+	rest := flags.Args()
+
+	switch {
+	case inline:
+		return execute("<expr>", *program, rest, *engine, true)
+	case len(rest) == 0:
+		if isTerminal(os.Stdin) {
+			repl.Start(os.Stdin, os.Stdout)
+			return exitOK
+		}
+		return executeReader("<stdin>", os.Stdin, rest, *engine)
+	case rest[0] == "-":
+		return executeReader("<stdin>", os.Stdin, rest[1:], *engine)
+	case rest[0] == "run":
+		if len(rest) < 2 {
+			fmt.Fprintln(os.Stderr, "sg run: missing file name")
+			flags.Usage()
+			return exitUsage
+		}
+		return executeFile(rest[1], rest[2:], *engine)
+	default:
+		return executeFile(rest[0], rest[1:], *engine)
+	}
+}
+
+func executeFile(path string, scriptArgs []string, engine string) int {
+	file, err := os.Open(path)
 	if err != nil {
-		fmt.Println("Error opening file:", err)
-		return
+		fmt.Fprintln(os.Stderr, "Error opening file:", err)
+		return exitIOError
 	}
 	defer file.Close()
+	return executeReader(path, file, scriptArgs, engine)
+}
+
+func executeReader(name string, in io.Reader, scriptArgs []string, engine string) int {
+	input, err := io.ReadAll(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading program:", err)
+		return exitIOError
+	}
+	return execute(name, string(input), scriptArgs, engine, false)
+}
+
+// execute runs source on the chosen backend. Script arguments are bound to
+// `args` in a scope around the program, so scripts may still define their own.
+func execute(name string, source string, scriptArgs []string, engine string, printResult bool) int {
+	p := parser.New(lexer.NewWithFile(source, name))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintln(os.Stderr, "\t"+msg)
+		}
+		return exitParseError
+	}
+
+	argsArray := &Item.Array{}
+	for _, arg := range scriptArgs {
+		argsArray.Elements = append(argsArray.Elements, &Item.String{Value: arg})
+	}
+	argsArray.Len = int64(len(argsArray.Elements))
+	argsArray.Capacity = argsArray.Len
+
+	globals := Item.NewScope()
+	globals.Set("args", argsArray)
+	globals.Modules = Item.NewModules(globals, searchPath())
+	if path, err := filepath.Abs(name); err == nil && !strings.HasPrefix(name, "<") {
+		// so that a module importing the program is reported as a cycle
+		globals.Modules.Begin(path, name)
+	}
+
+	var result Item.Item
+	if engine == "vm" {
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			fmt.Fprintln(os.Stderr, "compilation failed:", err)
+			return exitParseError
+		}
+		machine := vm.New(comp.Bytecode())
+		machine.SetGlobal("args", argsArray)
+		machine.SetModules(globals.Modules)
+		if err := machine.Run(); err != nil {
+			fmt.Fprintln(os.Stderr, "vm failed:", err)
+			return exitRuntimeError
+		}
+		result = machine.Result()
+	} else {
+		result = evaluator.Eval(program, Item.NewEnclosedScope(globals))
+	}
 
-	// Start the REPL, reading from the file and writing to stdout
-	//file or os.Stdin
-	repl.Start(file, os.Stdout)
+	if err, ok := result.(*Item.Error); ok {
+		fmt.Fprintln(os.Stderr, err.Traceback())
+		return exitRuntimeError
+	}
+	if printResult && result != nil && result != evaluator.NULL {
+		fmt.Println(result.Output())
+	}
+	return exitOK
+}
+
+// searchPath returns the directories listed in $SGPATH, where imported
+// modules are looked for after the importing file's directory.
+func searchPath() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv("SGPATH")) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The tests run programs through run, the way the sg command does, once on
+// each backend. Both have to print the same thing and exit the same way.
+
+// outcome is what running a program printed and its exit code. Paths of the
+// program's directory are left out of the output.
+type outcome struct {
+	stdout string
+	stderr string
+	code   int
+}
+
+// runFiles writes files to a new directory and runs main.sg from it on the
+// given backend. Paths in the output are made relative to that directory.
+func runFiles(t *testing.T, engine string, files map[string]string, flags ...string) outcome {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	output := t.TempDir()
+	stdout, err := os.Create(filepath.Join(output, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(output, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdout, stderr
+	defer func() { os.Stdout, os.Stderr = oldStdout, oldStderr }()
+	arguments := append(append([]string{"-engine", engine}, flags...), filepath.Join(dir, "main.sg"))
+	code := run(arguments)
+
+	read := func(name string) string {
+		text, err := os.ReadFile(filepath.Join(output, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths := strings.NewReplacer(dir+string(filepath.Separator), "", dir, ".")
+		return strings.TrimSuffix(paths.Replace(string(text)), "\n")
+	}
+	return outcome{stdout: read("stdout"), stderr: read("stderr"), code: code}
+}
+
+// runBoth runs the program on both backends, failing the test when they do
+// not agree, and returns what it did.
+func runBoth(t *testing.T, files map[string]string, flags ...string) outcome {
+	t.Helper()
+	eval := runFiles(t, "eval", files, flags...)
+	vm := runFiles(t, "vm", files, flags...)
+	if eval != vm {
+		t.Errorf("the backends disagree\neval: %+v\nvm:   %+v", eval, vm)
+	}
+	return eval
+}
+
+// programTest is a program and what it prints, out on stdout and, when it
+// stops with a runtime error, err on stderr.
+type programTest struct {
+	name   string
+	source string
+	out    string
+	err    string
+}
+
+func checkPrograms(t *testing.T, tests []programTest, flags ...string) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := outcome{stdout: tt.out, stderr: tt.err}
+			if tt.err != "" {
+				want.code = exitRuntimeError
+			}
+			got := runBoth(t, map[string]string{"main.sg": tt.source}, flags...)
+			if got != want {
+				t.Errorf("got %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestBackendsAgree(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"arithmetic", "puts(1 + 2 * 3, (1 + 2) * 3, 7 / 2, -7 / 2)", "7 9 3 -3", ""},
+		{"closures", `
+let counter = fun() {
+  let n = 0
+  fun() { n += 1; n }
+}
+let next = counter()
+next()
+puts(next(), next())`, "2 3", ""},
+		{"recursion", `
+let fib = fun(n) { if (n < 2) { return n }; fib(n - 1) + fib(n - 2) }
+puts(fib(20))`, "6765", ""},
+		{"if without else", "puts(if (false) { 1 })", "null", ""},
+		{"strings", `puts("a" + "b", len("hello"))`, "ab 5", ""},
+		{"unknown variable", "puts(1)\nputs(x)", "1", "ERROR: main.sg:2:6: identifier not found: x"},
+	})
+}
+
+// Mistakes the evaluator only finds when it runs into them are raised there
+// by the vm too, after everything before them has run.
+func TestMistakesRaisedWhenReached(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		out   string
+		err   string
+	}{
+		{"let twice", map[string]string{"main.sg": "puts(\"hi\"); let x = 1; let x = 2"},
+			"hi", "ERROR: main.sg:1:24: Variable x already is defined in this function's scope!"},
+		{"let twice computes the value first", map[string]string{"main.sg": "let x = 1\nlet x = puts(\"value\")"},
+			"value", "ERROR: main.sg:2:1: Variable x already is defined in this function's scope!"},
+		{"let twice where it never runs", map[string]string{"main.sg": "if (false) { let y = 1; let y = 2 }\nputs(\"fine\")"},
+			"fine", ""},
+		{"let twice caught", map[string]string{"main.sg": "try { let q = 1; let q = 2 } catch (e) { puts(e.message) }"},
+			"Variable q already is defined in this function's scope!", ""},
+		{"import twice", map[string]string{"main.sg": "puts(\"main\")\nimport lib\nimport lib", "lib.sg": "puts(\"lib\")"},
+			"main\nlib", "ERROR: main.sg:3:1: Variable lib already is defined in this function's scope!"},
+		{"break outside loop", map[string]string{"main.sg": "puts(1)\nif (true) {\n  break\n}"},
+			"1", "ERROR: main.sg:3:3: break outside loop"},
+		{"continue outside loop", map[string]string{"main.sg": "continue"},
+			"", "ERROR: main.sg:1:1: continue outside loop"},
+		{"break in a function never called", map[string]string{"main.sg": "fun f() { break }\nputs(\"fine\")"},
+			"fine", ""},
+		{"break in a function", map[string]string{"main.sg": "fun f() {\n  break\n}\nwhile (true) { f() }"},
+			"", "ERROR: main.sg:2:3: break outside loop\nTraceback (most recent call first):\n  in f, called at main.sg:4:16"},
+		{"break passes the catch but not the finally", map[string]string{"main.sg": `
+fun f() { try { break } catch (e) { puts("inside") } finally { puts("finally") } }
+try { f() } catch (e) { puts("outside", e.message) }`},
+			"finally\noutside break outside loop", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := outcome{stdout: tt.out, stderr: tt.err}
+			if tt.err != "" {
+				want.code = exitRuntimeError
+			}
+			if got := runBoth(t, tt.files); got != want {
+				t.Errorf("got %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string // the first error
+	}{
+		{"let = 1", "\tmain.sg:1:5: Expected next token to be IDENT, got =."},
+		{"if (true) {\n  puts(1)", "\tmain.sg:1:11: the block opened here is never closed with }"},
+		{"fun f(x) {", "\tmain.sg:1:10: the block opened here is never closed with }"},
+	}
+	for _, tt := range tests {
+		for _, engine := range []string{"eval", "vm"} {
+			got := runFiles(t, engine, map[string]string{"main.sg": tt.source})
+			if first, _, _ := strings.Cut(got.stderr, "\n"); got.code != exitParseError || first != tt.err {
+				t.Errorf("%s: %q gave %+v, want %q", engine, tt.source, got, tt.err)
+			}
+		}
+	}
+}
+
+// A program, a function body or a block has the value of its last statement
+// only when that is an expression.
+func TestStatementValues(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"functions", `
+fun a() { try { 1 } catch { } }
+fun b() { try { 1 } finally { 3 } }
+fun c() { for (x in [1]) { x } }
+fun d() { for (let i = 0; i < 1; i += 1) { i } }
+fun e() { let i = 0; while (i < 1) { i += 1; 7 } }
+fun f() { 5; let q = 1 }
+fun g() { if (true) { 7 } }
+puts(a(), b(), c(), d(), e(), f(), g())`, "null null null null null null 7", ""},
+		{"blocks", "puts(if (true) { for (x in [1]) { x } }, if (true) { 1; let y = 2 }, if (true) { 3 })", "null null 3", ""},
+	})
+
+	for _, tt := range []struct{ program, want string }{
+		{"1 + 2", "3"},
+		{"5; let y = 1", ""},
+		{"5; for (x in [1]) { x }", ""},
+		{"5; try { 1 } catch {}", ""},
+		{"if (true) { 4 }", "4"},
+	} {
+		for _, engine := range []string{"eval", "vm"} {
+			got := runFiles(t, engine, map[string]string{"main.sg": ""}, "-e", tt.program)
+			if got != (outcome{stdout: tt.want}) {
+				t.Errorf("%s: sg -e %q printed %+v, want %q", engine, tt.program, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestScriptArguments(t *testing.T) {
+	// With -e the path of main.sg is the last argument to the program.
+	got := runBoth(t, map[string]string{"main.sg": ""}, "-e", "puts(len(args), args); args[0]", "a", "b c")
+	if want := (outcome{stdout: "3 [a, b c, main.sg]\na"}); got != want {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
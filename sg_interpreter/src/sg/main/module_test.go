@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const numbers = `puts("loading numbers")
+let step = fun(a, b) { if (b == 0) { a } else { step(b, a % b) } }
+export let gcd = fun(a, b) { step(a, b) }`
+
+func TestModules(t *testing.T) {
+	t.Setenv("SGPATH", "")
+	tests := []struct {
+		name  string
+		files map[string]string
+		out   string
+		err   string
+	}{
+		{"by path and by name", map[string]string{
+			"main.sg":        "import \"lib/numbers.sg\"\nimport helper\nputs(numbers.gcd(12, 18), helper.twice(12, 18))",
+			"helper.sg":      "import \"lib/numbers.sg\"\nexport let twice = fun(a, b) { numbers.gcd(a, b) * 2 }",
+			"lib/numbers.sg": numbers,
+		}, "loading numbers\n6 12", ""},
+		{"private variable", map[string]string{
+			"main.sg":        "import \"lib/numbers.sg\"\nputs(numbers.step)",
+			"lib/numbers.sg": numbers,
+		}, "loading numbers", "ERROR: main.sg:2:13: module numbers does not export step"},
+		{"cycle", map[string]string{
+			"main.sg": "puts(\"start\")\nimport a",
+			"a.sg":    "import b\nexport let x = 1",
+			"b.sg":    "import a\nexport let y = 2",
+		}, "start", `ERROR: b.sg:1:1: import cycle: a.sg -> b.sg -> a.sg
+Traceback (most recent call first):
+  in <module b.sg>, called at a.sg:1:1
+  in <module a.sg>, called at main.sg:2:1`},
+		{"importing the program itself", map[string]string{
+			"main.sg": "import lib",
+			"lib.sg":  "import main",
+		}, "", `ERROR: lib.sg:1:1: import cycle: main.sg -> lib.sg -> main.sg
+Traceback (most recent call first):
+  in <module lib.sg>, called at main.sg:1:1`},
+		{"error while loading", map[string]string{
+			"main.sg": "puts(\"before\")\nimport bad",
+			"bad.sg":  "export let v = 1 + \"a\"",
+		}, "before", `ERROR: bad.sg:1:18: type mismatch: INTEGER + STRING
+Traceback (most recent call first):
+  in <module bad.sg>, called at main.sg:2:1`},
+		{"name already in use", map[string]string{
+			"main.sg": "let lib = 1\nimport lib",
+			"lib.sg":  "puts(\"loaded\")",
+		}, "", "ERROR: main.sg:2:1: Variable lib already is defined in this function's scope!"},
+		{"variables of their own", map[string]string{
+			"main.sg":    "import counter\nlet count = 10\ncounter.add()\nputs(counter.add(), count, counter.count)",
+			"counter.sg": "export let count = 0\nexport let add = fun() { count += 1; count }",
+		}, "2 10 2", ""},
+		{"defined after use", map[string]string{
+			"main.sg": "import lib\nputs(lib.f())",
+			"lib.sg":  "export let f = fun() { g() }\nlet g = fun() { \"g\" }",
+		}, "g", ""},
+		{"host globals", map[string]string{
+			"main.sg": "import lib\nputs(lib.count)",
+			"lib.sg":  "export let count = len(args)",
+		}, "0", ""},
+		{"error in a function of a module", map[string]string{
+			"main.sg": "import lib\nlib.f()",
+			"lib.sg":  "export fun f() { g() }\nfun g() { 1 + \"a\" }",
+		}, "", `ERROR: lib.sg:2:13: type mismatch: INTEGER + STRING
+Traceback (most recent call first):
+  in g, called at lib.sg:1:18
+  in f, called at main.sg:2:4`},
+		{"missing", map[string]string{"main.sg": "import nothing"},
+			"", `ERROR: main.sg:1:1: module "nothing.sg" not found, searched .`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := outcome{stdout: tt.out, stderr: tt.err}
+			if tt.err != "" {
+				want.code = exitRuntimeError
+			}
+			if got := runBoth(t, tt.files); got != want {
+				t.Errorf("got %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestModuleSearchPath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "far.sg"), []byte(`export let where = "SGPATH"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SGPATH", dir)
+	want := outcome{stdout: "SGPATH"}
+	if got := runBoth(t, map[string]string{"main.sg": "import far\nputs(far.where)"}); got != want {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestImportOnlyAtTheTop(t *testing.T) {
+	for _, source := range []string{
+		"if (true) { import helper }",
+		"let f = fun() { export let z = 1 }",
+	} {
+		if got := runBoth(t, map[string]string{"main.sg": source}); got.code != exitParseError {
+			t.Errorf("%q: got %+v, want a parse error", source, got)
+		}
+	}
+}
+
+func TestCallsNestAcrossModules(t *testing.T) {
+	// the calls running in the program count towards the limit in a module's
+	// functions, and the module takes a frame while it is imported
+	lib := "export let down = fun(n) { if (n > 0) { down(n - 1) } else { \"bottom\" } }"
+	for _, tt := range []struct {
+		name  string
+		files map[string]string
+		first string
+	}{
+		{"calling", map[string]string{
+			"main.sg": "import lib\nlet f = fun(n) { if (n == 0) { lib.down(10) } else { f(n - 1) } }\nputs(f(16360))\nf(16375)",
+			"lib.sg":  lib,
+		}, "ERROR: lib.sg:1:41: stack overflow: more than 16384 nested calls"},
+		{"importing", map[string]string{
+			"main.sg": "import deep",
+			"deep.sg": lib + "\nputs(down(16381))\ndown(16382)",
+		}, "ERROR: deep.sg:1:41: stack overflow: more than 16384 nested calls"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runBoth(t, tt.files)
+			first, _, _ := strings.Cut(got.stderr, "\n")
+			if first != tt.first || got.code != exitRuntimeError {
+				t.Errorf("got %+v, want %q", got, tt.first)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestOperators(t *testing.T) {
+	checkExpressions(t, []expressionTest{
+		{"7 % 3", "1"},
+		{"-7 % 3", "-1"},
+		{"7 % -3", "1"},
+		{"2 <= 2", "true"},
+		{"3 >= 4", "false"},
+		{"\"a\" <= \"b\"", "true"},
+		{"true && false", "false"},
+		{"false || true", "true"},
+		{"1 && 2", "true"},
+		{"false || \"x\"", "true"},
+		{"6 & 3", "2"},
+		{"6 | 3", "7"},
+		{"6 ^ 3", "5"},
+		{"~5", "-6"},
+		{"1 << 10", "1024"},
+		{"-16 >> 2", "-4"},
+		{"1 << -1", "ValueError: negative shift count: -1"},
+		{"true ^ true", "false"},
+		{"1 + 2 * 3 % 4", "3"},
+		{"1 | 2 ^ 3 & 4", "3"},
+		{"1 < 2 == true", "true"},
+		{"!true || true && false", "false"},
+		{"1 << 2 + 1", "5"},
+		{"\"a\" & \"b\"", "TypeError: unknown operator: STRING & STRING"},
+	})
+}
+
+func TestShortCircuit(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"&& skips the right side", "let f = fun() { puts(\"called\"); true }\nputs(false && f())", "false", ""},
+		{"|| skips the right side", "let f = fun() { puts(\"called\"); true }\nputs(true || f())", "true", ""},
+		{"the right side runs when needed", "let f = fun() { puts(\"called\"); 1 }\nputs(true && f())", "called\ntrue", ""},
+	})
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"every operator", `
+let x = 10
+x += 5; puts(x)
+x -= 3; puts(x)
+x *= 2; puts(x)
+x /= 5; puts(x)
+x %= 3; puts(x)
+x <<= 4; puts(x)
+x >>= 1; puts(x)
+x |= 1; puts(x)
+x &= 12; puts(x)
+x ^= 5; puts(x)`, "15\n12\n24\n4\n1\n16\n8\n9\n8\n13", ""},
+		{"strings", "let s = \"a\"\ns += \"b\"\nputs(s)", "ab", ""},
+		{"undeclared", "y += 1", "", "ERROR: main.sg:1:1: identifier not found: y"},
+	})
+}
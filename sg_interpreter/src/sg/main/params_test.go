@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestFunctionDeclarations(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"named", "fun add(a, b) { a + b }\nputs(add(1, 2))", "3", ""},
+		{"semicolon after the declaration", "fun add(a, b) { a + b }; puts(add(1, 2))", "3", ""},
+		{"recursive", "fun fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }\nputs(fact(20))", "2432902008176640000", ""},
+	})
+}
+
+func TestParameters(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"defaults and rest", `
+fun g(a, b = a * 2, ...rest) { [a, b, rest] }
+puts(g(1), g(1, 5), g(1, 2, 3, 4))`, "[1, 2, []] [1, 5, []] [1, 2, [3, 4]]", ""},
+		{"named arguments", `
+fun g(a, b = a * 2, ...rest) { [a, b, rest] }
+puts(g(1, b = 7), g(b = 3, a = 2))`, "[1, 7, []] [2, 3, []]", ""},
+		{"defaults are computed on every call", `
+let counter = 0
+fun tick(x = fun() { counter += 1; counter }()) { x }
+puts(tick(), tick(), tick(5), counter)`, "1 2 5 2", ""},
+		{"defaults see the enclosing scope", "let d = 10\nfun late(x = d) { x }\nputs(late())", "10", ""},
+		{"function literals", "let f = fun(x, y = \"default\") { [x, y] }\nputs(f(1), f(1, y = 2))", "[1, default] [1, 2]", ""},
+		{"only a rest parameter", "fun count(...all) { len(all) }\nputs(count(), count(1, 2, 3))", "0 3", ""},
+	})
+}
+
+func TestArgumentErrors(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"too few", "fun f(a, b) { a }\nf(1)",
+			"", "ERROR: main.sg:2:1: wrong number of arguments: want=2, got=1"},
+		{"too many", "fun f(a) { a }\nf(1, 2)",
+			"", "ERROR: main.sg:2:1: wrong number of arguments: want=1, got=2"},
+		{"unknown name", "fun f(a) { a }\nf(b = 1)",
+			"", "ERROR: main.sg:2:1: unexpected argument b"},
+		{"rest parameter by name", "fun f(...r) { r }\nf(r = [1])",
+			"", "ERROR: main.sg:2:1: unexpected argument r"},
+		{"given twice", "fun f(a) { a }\nf(1, a = 2)",
+			"", "ERROR: main.sg:2:1: argument a given twice"},
+	})
+}
+
+func TestParameterListErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{"fun f(a = 1, b) { a }", "\tmain.sg:1:14: parameter b needs a default value, like the ones before it"},
+		{"fun f(...r, a) { a }", "\tmain.sg:1:10: the rest parameter r must be the last one"},
+		{"fun f(a, a) { a }", "\tmain.sg:1:10: duplicate parameter a"},
+	}
+	for _, tt := range tests {
+		want := outcome{stderr: tt.err, code: exitParseError}
+		if got := runBoth(t, map[string]string{"main.sg": tt.source}); got != want {
+			t.Errorf("%q: got %+v\nwant %+v", tt.source, got, want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestErrorPositions(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"operator", "let a = 1\nlet b = a + \"x\"",
+			"", "ERROR: main.sg:2:11: type mismatch: INTEGER + STRING"},
+		{"nested expression", "puts(1 +\n  (2 * -true))",
+			"", "ERROR: main.sg:2:8: unknown operator: -BOOLEAN"},
+		{"index assignment", "let arr = [1]\narr[5] = 2",
+			"", "ERROR: main.sg:2:1: index 5 out of range for array of length 1"},
+		{"call of a non function", "let x = 1\n   x(2)",
+			"", "ERROR: main.sg:2:4: not a function: INTEGER"},
+		{"builtin", "puts(len(1))",
+			"", "ERROR: main.sg:1:6: Argument `len` not supported. Received INTEGER"},
+		{"inside a block", "if (true) {\n\tlet y = missing\n}",
+			"", "ERROR: main.sg:2:10: identifier not found: missing"},
+		{"caught error", "try {\n  1 % 0\n} catch (e) { puts(e.line, e.column) }",
+			"2 5", ""},
+	})
+}
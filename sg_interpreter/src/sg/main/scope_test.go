@@ -0,0 +1,128 @@
+package main
+
+import "testing"
+
+func TestBlockScoping(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"block variable ends with the block", `
+if (true) { let inner = 1 }
+puts(inner)`, "", "ERROR: main.sg:3:6: identifier not found: inner"},
+		{"nested blocks see outer variables", `
+let a = 1
+if (true) { if (true) { puts(a) } }`, "1", ""},
+		{"functions see the block they are made in", `
+let f = if (true) { let hidden = "seen"; fun() { hidden } }
+puts(f())`, "seen", ""},
+		{"while body", `
+let i = 0
+while (i < 2) { let step = 1; i += step }
+puts(i)
+puts(step)`, "2", "ERROR: main.sg:5:6: identifier not found: step"},
+		{"every iteration gets a new body scope", `
+for (x in [1, 2]) { let y = x * 10; puts(y) }`, "10\n20", ""},
+	})
+}
+
+func TestShadowing(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"nested block hides the outer variable", `
+let a = 1
+if (true) { let a = 2; puts(a) }
+puts(a)`, "2\n1", ""},
+		{"assignment goes to the shadowing variable", `
+let a = 1
+if (true) { let a = 2; a = 3; puts(a) }
+puts(a)`, "3\n1", ""},
+		{"function body hides a global", `
+let name = "global"
+let f = fun() { let name = "local"; name }
+puts(f(), name)`, "local global", ""},
+		{"parameter hides a global", `
+let x = 1
+let f = fun(x) { x * 2 }
+puts(f(5), x)`, "10 1", ""},
+		{"loop variable hides a global", `
+let i = "outer"
+for (let i = 0; i < 2; i += 1) { puts(i) }
+for (i in [7]) { puts(i) }
+puts(i)`, "0\n1\n7\nouter", ""},
+	})
+}
+
+func TestRedeclaration(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"twice at the top", "let a = 1\nlet a = 2",
+			"", "ERROR: main.sg:2:1: Variable a already is defined in this function's scope!"},
+		{"twice in a block", "if (true) {\n  let a = 1\n  let a = 2\n}",
+			"", "ERROR: main.sg:3:3: Variable a already is defined in this function's scope!"},
+		{"function declaration over a variable", "let f = 1\nfun f() { 2 }",
+			"", "ERROR: main.sg:2:1: Variable f already is defined in this function's scope!"},
+		{"in separate blocks", `
+if (true) { let a = 1; puts(a) }
+if (true) { let a = 2; puts(a) }`, "1\n2", ""},
+		{"parameter", "let f = fun(a) {\n  let a = 1\n}\nf(1)",
+			"", "ERROR: main.sg:2:3: Variable a already is defined in this function's scope!\nTraceback (most recent call first):\n  in f, called at main.sg:4:1"},
+	})
+}
+
+func TestAssignment(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"from a nested block", `
+let total = 0
+if (true) { if (true) { total = 5 } }
+puts(total)`, "5", ""},
+		{"from a function", `
+let total = 0
+let add = fun(x) { total = total + x }
+add(3)
+add(4)
+puts(total)`, "7", ""},
+		{"from a closure to its enclosing function", `
+let make = fun() {
+  let n = 0
+  let inc = fun() { n += 1 }
+  inc()
+  inc()
+  n
+}
+puts(make())`, "2", ""},
+		{"to the nearest of several", `
+let a = "global"
+let f = fun() {
+  let a = "function"
+  if (true) { a = "assigned" }
+  a
+}
+puts(f(), a)`, "assigned global", ""},
+		{"undeclared variable", "puts(1)\nnope = 1",
+			"1", "ERROR: main.sg:2:1: Variable nope not defined in current scope!"},
+	})
+}
+
+func TestLoopHeaderScope(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"for variable ends with the loop", "for (let i = 0; i < 1; i += 1) {}\nputs(i)",
+			"", "ERROR: main.sg:2:6: identifier not found: i"},
+		{"for-in variable ends with the loop", "for (x in [1]) {}\nputs(x)",
+			"", "ERROR: main.sg:2:6: identifier not found: x"},
+		{"loops in a row reuse the name", `
+for (let i = 0; i < 1; i += 1) { puts(i) }
+for (let i = 5; i < 6; i += 1) { puts(i) }
+for (k, v in {"a": 1}) { puts(k, v) }
+for (k, v in {"b": 2}) { puts(k, v) }`, "0\n5\na 1\nb 2", ""},
+		{"body may declare the header's name", `
+for (let i = 0; i < 2; i += 1) { let i = "body"; puts(i) }`, "body\nbody", ""},
+		{"closures share the for variable", `
+let fs = []
+for (let i = 0; i < 3; i += 1) { push(fs, fun() { i }) }
+puts(map(fs, fun(f) { f() }))`, "[3, 3, 3]", ""},
+		{"closures get their own for-in variable", `
+let fs = []
+for (x in [1, 2, 3]) { push(fs, fun() { x }) }
+puts(map(fs, fun(f) { f() }))`, "[1, 2, 3]", ""},
+		{"header assigns to an outer variable", `
+let i = 0
+for (i = 3; i < 5; i += 1) {}
+puts(i)`, "5", ""},
+	})
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestSort(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"comparable values", `
+puts(sort([3, 1, 2]), sort(["b", "a", "c"]), sort([2.5, 1, 3, -0.5]), sort([[2, 1], [1, 5], [1, 2]]), sort([]))`,
+			"[1, 2, 3] [a, b, c] [-0.5, 1, 2.5, 3] [[1, 2], [1, 5], [2, 1]] []", ""},
+		{"in place", "let a = [5, 4]\nlet b = sort(a)\nputs(a, b == a)", "[4, 5] true", ""},
+		{"stable with a key", `
+let people = [["bob", 25], ["ann", 31], ["cid", 25], ["dan", 31]]
+puts(sort_by(people, fun(p) { p[1] }))`, "[[bob, 25], [cid, 25], [ann, 31], [dan, 31]]", ""},
+		{"stable with a comparison", `
+let people = [["bob", 25], ["ann", 31], ["cid", 25], ["dan", 31]]
+puts(sort(people, fun(a, b) { b[1] - a[1] }))`, "[[ann, 31], [dan, 31], [bob, 25], [cid, 25]]", ""},
+		{"key called once per element", `
+let calls = 0
+puts(sort_by(map(range(10), fun(x) { x }), fun(x) { calls += 1; -x }), calls)`, "[9, 8, 7, 6, 5, 4, 3, 2, 1, 0] 10", ""},
+		{"reversed input", "puts(sort(reverse(map(range(2000), fun(x) { x })))[0:3])", "[0, 1, 2]", ""},
+	})
+}
+
+func TestSortErrors(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"values that do not compare", "sort([1, \"a\"])",
+			"", "ERROR: main.sg:1:1: type mismatch: STRING < INTEGER"},
+		{"hashes", "sort([{}, {}])",
+			"", "ERROR: main.sg:1:1: unknown operator: HASH < HASH"},
+		{"comparison that raises", "sort([1, 2, 3], fun(a, b) { throw \"no\" })",
+			"", "ERROR: main.sg:1:29: no\nTraceback (most recent call first):\n  in <anonymous>, called at main.sg:1:1"},
+		{"comparison that returns a string", "sort([1, 2], fun(a, b) { \"x\" })",
+			"", "ERROR: main.sg:1:1: comparison function of `sort` must return INTEGER or FLOAT, not STRING"},
+		{"comparison that is not a function", "sort([1, 2], 3)",
+			"", "ERROR: main.sg:1:1: not a function: INTEGER"},
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []expressionTest{
+		{`split("a,b,,c", ",")`, "[a, b, , c]"},
+		{"split(\" a  b \t c \")", "[a, b, c]"},
+		{`split("abc", "")`, "[a, b, c]"},
+		{`join(["x", "y", "z"], "-")`, "x-y-z"},
+		{`index_of("hello", "l")`, "2"},
+		{`index_of("hello", "z")`, "-1"},
+		{`index_of([1, 2, 3], 2)`, "1"},
+		{`contains("hello", "ell")`, "true"},
+		{`contains([[1]], [1])`, "true"},
+		{`starts_with("hello", "he")`, "true"},
+		{`ends_with("hello", "x")`, "false"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`upper("abC1") + lower("ABc1")`, "ABC1abc1"},
+		{`"[" + trim("  x y  ") + "]"`, "[x y]"},
+		{`trim("--x--", "-")`, "x"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`substr("hello", 1)`, "ello"},
+		{`substr("hello", 3, 10)`, "lo"},
+		{`substr("abc", 5)`, "IndexError: `substr` start 5 out of range for string of length 3"},
+		{`repeat("a", -1)`, "ValueError: `repeat` needs a count of at least 0, got -1"},
+		{`join([1, 2], ",")`, "TypeError: `join` needs an array of STRING, element 0 is INTEGER"},
+		{`upper(1)`, "TypeError: Arguments to `upper` must be STRING. Received INTEGER"},
+	}
+	checkExpressions(t, tests)
+}
+
+func TestStringIndexing(t *testing.T) {
+	checkExpressions(t, []expressionTest{
+		{`"hello"[0]`, "h"},
+		{`"hello"[4]`, "o"},
+		{`"hello"[5]`, "null"},
+		{`"hello"[-1]`, "null"},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[:2]`, "he"},
+		{`"hello"[3:]`, "lo"},
+		{`len("hello"[2:1])`, "0"},
+		// strings are bytes, "é" is two of them in UTF-8
+		{`len("é")`, "2"},
+		{`len("aé"[1])`, "1"},
+		{`"aé"[1] + "aé"[2] == "é"`, "true"},
+		{`"aéb"[1:3]`, "é"},
+		{`"aéb"[3]`, "b"},
+	})
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestTracebacks(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"one call", "let f = fun() {\n  1 / 0\n}\nf()", "", `ERROR: main.sg:2:5: division by zero
+Traceback (most recent call first):
+  in f, called at main.sg:4:1`},
+		{"nested calls", "let inner = fun(x) { x.y }\nlet outer = fun(x) { inner(x) }\nouter(1)", "", `ERROR: main.sg:1:23: INTEGER has no members, can't get y
+Traceback (most recent call first):
+  in inner, called at main.sg:2:22
+  in outer, called at main.sg:3:1`},
+		{"recursion is folded", "let down = fun(n) { if (n == 0) { missing }; down(n - 1) }\ndown(5)", "", `ERROR: main.sg:1:35: identifier not found: missing
+Traceback (most recent call first):
+  in down, called at main.sg:1:46
+  [previous call repeated 4 more times]
+  in down, called at main.sg:2:1`},
+		{"through a builtin callback", "map([1], fun(x) {\n  x + \"s\"\n})", "", `ERROR: main.sg:2:5: type mismatch: INTEGER + STRING
+Traceback (most recent call first):
+  in <anonymous>, called at main.sg:1:1`},
+		{"function in a hash", "let h = {\"f\": fun() { pop([]) }}\nh[\"f\"]()", "", `ERROR: main.sg:1:23: ` + "`pop`" + ` from an empty array
+Traceback (most recent call first):
+  in <anonymous>, called at main.sg:2:2`},
+		{"rethrown keeps the first place", "let f = fun() { throw \"boom\" }\ntry { f() } catch (e) { throw e }", "", `ERROR: main.sg:1:17: boom
+Traceback (most recent call first):
+  in f, called at main.sg:2:7`},
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestTryCatch(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"catch and finally", `
+try { puts("a"); [1][5] = 0; puts("b") } catch (e) {
+  puts(e.type, e.message, e.line, e.column)
+} finally { puts("finally") }`,
+			"a\nIndexError index 5 out of range for array of length 1 2 18\nfinally", ""},
+		{"catch without a name", "try { push(1, 2) } catch { puts(\"caught\") }", "caught", ""},
+		{"semicolon after the statement", "try { 1 } finally { puts(1) }; puts(2)", "1\n2", ""},
+		{"printing the error", "try { missing } catch (e) { puts(e) }", "NameError: identifier not found: missing", ""},
+		{"the caught name is local", `
+let e = "outer"
+try { throw "x" } catch (e) { }
+puts(e)`, "outer", ""},
+		{"finally after return", `
+let f = fun() { try { return 1 } finally { puts("cleanup") } }
+puts(f())`, "cleanup\n1", ""},
+		{"finally after break and continue", `
+let i = 0
+while (i < 5) {
+  i += 1
+  try { if (i == 2) { continue }; if (i == 4) { break }; puts(i) } finally { puts("f", i) }
+}`, "1\nf 1\nf 2\n3\nf 3\nf 4", ""},
+		{"error from a called function", `
+let f = fun(n) { if (n == 0) { throw "deep" }; f(n - 1) }
+try { f(3) } catch (e) { puts(e.message, e.line) }`, "deep 2", ""},
+	})
+}
+
+func TestThrow(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"strings and error values", `
+try { throw "boom" } catch (e) { puts(e.type, e.message) }
+try { throw error("bad", "MyError") } catch (e) { puts(e.type, e.message) }`, "Error boom\nMyError bad", ""},
+		{"other values", "try { throw 1 } catch (e) { puts(e.type, e.message) }",
+			"TypeError can only throw ERROR_VALUE or STRING, not INTEGER", ""},
+		{"rethrow keeps the position", `
+let f = fun() {
+  try { 1 / 0 } catch (e) { puts("caught"); throw e }
+}
+f()`, "caught", `ERROR: main.sg:3:11: division by zero
+Traceback (most recent call first):
+  in f, called at main.sg:5:1`},
+		{"from catch", `try { throw "first" } catch (e) { throw "second" } finally { puts("still runs") }`,
+			"still runs", "ERROR: main.sg:1:35: second"},
+		{"from finally", `try { 1 } finally { throw "from finally" }`,
+			"", "ERROR: main.sg:1:21: from finally"},
+	})
+}
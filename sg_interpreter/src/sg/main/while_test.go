@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestWhileLoops(t *testing.T) {
+	checkPrograms(t, []programTest{
+		{"counts", "let i = 0\nwhile (i < 3) { puts(i); i += 1 }", "0\n1\n2", ""},
+		{"never runs", "while (false) { puts(1) }\nputs(2)", "2", ""},
+		{"semicolon after the loop", "let i = 0\nwhile (i < 1) { i += 1 }; puts(i)", "1", ""},
+		{"break", "let i = 0\nwhile (true) { i += 1; if (i == 3) { break } }\nputs(i)", "3", ""},
+		{"continue", "let i = 0\nwhile (i < 5) { i += 1; if (i % 2 == 0) { continue }; puts(i) }", "1\n3\n5", ""},
+		{"break leaves the innermost loop", `
+let i = 0
+while (i < 2) {
+  i += 1
+  let j = 0
+  while (true) { j += 1; if (j > 1) { break } }
+  puts(i, j)
+}`, "1 2\n2 2", ""},
+		{"return from inside", `
+let find = fun(arr, x) {
+  let i = 0
+  while (i < len(arr)) { if (arr[i] == x) { return i }; i += 1 }
+  -1
+}
+puts(find([4, 5, 6], 6), find([], 1))`, "2 -1", ""},
+		{"break in a for loop", "for (let i = 0; i < 10; i += 1) { if (i == 2) { break }; puts(i) }", "0\n1", ""},
+		{"semicolon after a for loop", "for (let i = 0; i < 2; i += 1) { puts(i) }; puts(2)", "0\n1\n2", ""},
+		{"semicolon after an empty for loop", "let n = 0\nfor (;n < 3;) { n += 1 };\nputs(n)", "3", ""},
+		{"continue in a for loop runs the post statement", "for (let i = 0; i < 3; i += 1) { if (i == 1) { continue }; puts(i) }", "0\n2", ""},
+		{"condition error", "let i = 0\nwhile (i < \"x\") {}", "", "ERROR: main.sg:2:10: type mismatch: INTEGER < STRING"},
+	})
+}
@@ -2,34 +2,66 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
+	"path"
 	"sg_interpreter/src/sg/ast"
 	"sg_interpreter/src/sg/lexer"
 	"sg_interpreter/src/sg/token"
 	"strconv"
+	"strings"
 )
 
 const (
 	LOWEST        = 1
-	EQUALS        = 2
-	LESSORGREATER = 3
-	SUM           = 4
-	PRODUCT       = 5
-	PREFIX        = 6
-	CALL          = 7
-	INDEX         = 8
+	OR            = 2
+	AND           = 3
+	EQUALS        = 4
+	LESSORGREATER = 5
+	SUM           = 6
+	PRODUCT       = 7
+	PREFIX        = 8
+	CALL          = 9
+	INDEX         = 10
 )
 
+// As in Go, the bitwise operators bind like + and *, so `x & 1 == 0`
+// compares the result of the &.
 var precedences = map[token.TokenType]int{
-	token.EQ:     EQUALS,
-	token.NOT_EQ: EQUALS,
-	token.LT:     LESSORGREATER,
-	token.GT:     LESSORGREATER,
-	token.MINUS:  SUM,
-	token.PLUS:   SUM,
-	token.STAR:   PRODUCT,
-	token.SLASH:  PRODUCT,
-	token.LP:     CALL,
-	token.LBP:    INDEX,
+	token.OR:      OR,
+	token.AND:     AND,
+	token.EQ:      EQUALS,
+	token.NOT_EQ:  EQUALS,
+	token.LT:      LESSORGREATER,
+	token.GT:      LESSORGREATER,
+	token.LT_EQ:   LESSORGREATER,
+	token.GT_EQ:   LESSORGREATER,
+	token.MINUS:   SUM,
+	token.PLUS:    SUM,
+	token.BIT_OR:  SUM,
+	token.BIT_XOR: SUM,
+	token.STAR:    PRODUCT,
+	token.SLASH:   PRODUCT,
+	token.MOD:     PRODUCT,
+	token.BIT_AND: PRODUCT,
+	token.SHL:     PRODUCT,
+	token.SHR:     PRODUCT,
+	token.LP:      CALL,
+	token.LBP:     INDEX,
+	token.DOT:     INDEX,
+}
+
+// compoundAssignments maps `x op= y` to the operator of `x = x op y`.
+var compoundAssignments = map[token.TokenType]string{
+	token.PLUS_SET:    token.PLUS,
+	token.MINUS_SET:   token.MINUS,
+	token.STAR_SET:    token.STAR,
+	token.SLASH_SET:   token.SLASH,
+	token.MOD_SET:     token.MOD,
+	token.BIT_AND_SET: token.BIT_AND,
+	token.BIT_OR_SET:  token.BIT_OR,
+	token.BIT_XOR_SET: token.BIT_XOR,
+	token.SHL_SET:     token.SHL,
+	token.SHR_SET:     token.SHR,
 }
 
 type (
@@ -39,15 +71,23 @@ type (
 
 type Parser struct {
 	lexer  *lexer.Lexer
-	errors []string
+	errors []Error
 
 	curToken  token.Token
 	peekToken token.Token
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	depth   int // how deeply the syntax tree being built is nested
+	tooDeep bool
 }
 
+// MaxNesting bounds how deeply expressions and blocks may nest. The parser,
+// the evaluator and the compiler all recurse over the syntax tree, and a Go
+// stack overflow can not be recovered from.
+const MaxNesting = 5000
+
 func (parser *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
 	parser.prefixParseFns[tokenType] = fn
 }
@@ -59,7 +99,7 @@ func (parser *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn)
 func New(lexer *lexer.Lexer) *Parser {
 	parser := &Parser{
 		lexer:  lexer,
-		errors: []string{},
+		errors: []Error{},
 	}
 	parser.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	parser.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -67,12 +107,14 @@ func New(lexer *lexer.Lexer) *Parser {
 	//Registering the respective functions to tokens
 	parser.registerPrefix(token.IDENT, parser.parseIdentifier)
 	parser.registerPrefix(token.INT, parser.parseIntegerLiteral)
+	parser.registerPrefix(token.FLOAT, parser.parseFloatLiteral)
 	parser.registerPrefix(token.STRING, parser.parseStringLiteral)
 	parser.registerPrefix(token.TRUE, parser.parseBoolean)
 	parser.registerPrefix(token.FALSE, parser.parseBoolean)
 
 	parser.registerPrefix(token.EXC, parser.parsePrefixExpression)
 	parser.registerPrefix(token.MINUS, parser.parsePrefixExpression)
+	parser.registerPrefix(token.BIT_NOT, parser.parsePrefixExpression)
 	parser.registerPrefix(token.LP, parser.parseGroupedExpressions)
 	parser.registerPrefix(token.IF, parser.parseIfExpression)
 	parser.registerPrefix(token.FUNCTION, parser.parseFunctionLiteral)
@@ -87,8 +129,15 @@ func New(lexer *lexer.Lexer) *Parser {
 	parser.registerInfix(token.NOT_EQ, parser.parseInfixExpression)
 	parser.registerInfix(token.LT, parser.parseInfixExpression)
 	parser.registerInfix(token.GT, parser.parseInfixExpression)
+	for _, tokenType := range []token.TokenType{
+		token.MOD, token.LT_EQ, token.GT_EQ, token.AND, token.OR,
+		token.BIT_AND, token.BIT_OR, token.BIT_XOR, token.SHL, token.SHR,
+	} {
+		parser.registerInfix(tokenType, parser.parseInfixExpression)
+	}
 	parser.registerInfix(token.LP, parser.parseCallExpression)
 	parser.registerInfix(token.LBP, parser.parseIndexExpression)
+	parser.registerInfix(token.DOT, parser.parseMemberExpression)
 
 	parser.nextToken()
 	parser.nextToken()
@@ -130,13 +179,39 @@ func (parser *Parser) curPrecedence() int {
 	return LOWEST
 }
 
+// Error is a syntax error found while parsing.
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e Error) String() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message
+	}
+	return e.Message
+}
+
+// Errors returns the syntax errors as text, each prefixed with its position.
 func (parser *Parser) Errors() []string {
+	messages := make([]string, len(parser.errors))
+	for i, e := range parser.errors {
+		messages[i] = e.String()
+	}
+	return messages
+}
+
+// ErrorList returns the syntax errors with their positions kept apart.
+func (parser *Parser) ErrorList() []Error {
 	return parser.errors
 }
 
+func (parser *Parser) addError(pos token.Position, format string, a ...interface{}) {
+	parser.errors = append(parser.errors, Error{Pos: pos, Message: fmt.Sprintf(format, a...)})
+}
+
 func (parser *Parser) peekError(tokenType token.TokenType) {
-	message := fmt.Sprintf("Expected next token to be %s, got %s.", tokenType, parser.peekToken.Type)
-	parser.errors = append(parser.errors, message)
+	parser.addError(parser.peekToken.Pos, "Expected next token to be %s, got %s.", tokenType, parser.peekToken.Type)
 }
 
 func (parser *Parser) parseIdentifier() ast.Expression {
@@ -147,8 +222,26 @@ func (parser *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(parser.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("Couldn't parse %q as an Integer", parser.curToken.Literal)
-		parser.errors = append(parser.errors, msg)
+		bigValue, ok := new(big.Int).SetString(parser.curToken.Literal, 0)
+		if !ok {
+			parser.addError(parser.curToken.Pos, "Couldn't parse %q as an Integer", parser.curToken.Literal)
+			return nil
+		}
+		lit.Big = bigValue
+		return lit
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func (parser *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: parser.curToken}
+
+	value, err := strconv.ParseFloat(parser.curToken.Literal, 64)
+	if err != nil {
+		parser.addError(parser.curToken.Pos, "Couldn't parse %q as a Float", parser.curToken.Literal)
 		return nil
 	}
 
@@ -158,8 +251,7 @@ func (parser *Parser) parseIntegerLiteral() ast.Expression {
 }
 
 func (parser *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	parser.errors = append(parser.errors, msg)
+	parser.addError(parser.curToken.Pos, "no prefix parse function for %s found", t)
 }
 func (parser *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: parser.curToken, Value: parser.curToken.Literal}
@@ -184,20 +276,62 @@ func (parser *Parser) parseStatement() ast.Statement {
 	if parser.curToken.Type == token.IDENT && parser.peekToken.Type == token.SET {
 		return parser.parseSetStatement()
 	}
+	if _, ok := compoundAssignments[parser.peekToken.Type]; ok && parser.curToken.Type == token.IDENT {
+		return parser.parseCompoundAssignment()
+	}
 	switch parser.curToken.Type {
 	case token.LET:
 		return parser.parseLetStatement()
+	case token.FUNCTION:
+		if parser.PeekTokenIsType(token.IDENT) {
+			return parser.parseFunctionDeclaration()
+		}
+		return parser.parseExpressionStatement()
 	case token.RETURN:
 		return parser.parseReturnStatement()
+	case token.IMPORT, token.EXPORT:
+		// the depth is only 0 outside of every block
+		if parser.depth > 0 {
+			parser.addError(parser.curToken.Pos, "%s is only allowed at the top level of a file", parser.curToken.Literal)
+			return nil
+		}
+		if parser.curToken.Type == token.IMPORT {
+			return parser.parseImportStatement()
+		}
+		return parser.parseExportStatement()
 	case token.FOR:
 		return parser.parseForStatement()
+	case token.WHILE:
+		return parser.parseWhileStatement()
+	case token.TRY:
+		return parser.parseTryStatement()
+	case token.THROW:
+		statement := &ast.ThrowStatement{Token: parser.curToken}
+		parser.nextToken()
+		statement.Value = parser.parseExpression(LOWEST)
+		if parser.PeekTokenIsType(token.SEMICOL) {
+			parser.nextToken()
+		}
+		return statement
+	case token.BREAK:
+		statement := &ast.BreakStatement{Token: parser.curToken}
+		if parser.PeekTokenIsType(token.SEMICOL) {
+			parser.nextToken()
+		}
+		return statement
+	case token.CONTINUE:
+		statement := &ast.ContinueStatement{Token: parser.curToken}
+		if parser.PeekTokenIsType(token.SEMICOL) {
+			parser.nextToken()
+		}
+		return statement
 	default:
 		return parser.parseExpressionStatement()
 	}
 }
 func (parser *Parser) parseSetStatement() ast.Statement {
 	statement := &ast.SetStatement{Token: parser.curToken}
-	statement.Id = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+	statement.Target = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
 
 	if !parser.ExpectPeek(token.SET) {
 		return nil
@@ -211,6 +345,32 @@ func (parser *Parser) parseSetStatement() ast.Statement {
 
 	return statement
 }
+
+// parseCompoundAssignment turns `x += y` into the SetStatement `x = x + y`.
+func (parser *Parser) parseCompoundAssignment() ast.Statement {
+	statement := &ast.SetStatement{Token: parser.curToken}
+	target := &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+	statement.Target = target
+
+	parser.nextToken()
+	operator := parser.curToken
+	operator.Type = token.TokenType(compoundAssignments[operator.Type])
+	operator.Literal = string(operator.Type)
+	parser.nextToken()
+	statement.Val = &ast.InfixExpression{
+		Token:    operator,
+		Operator: operator.Literal,
+		Left:     target,
+		Right:    parser.parseExpression(LOWEST),
+	}
+
+	if parser.PeekTokenIsType(token.SEMICOL) {
+		parser.nextToken()
+	}
+
+	return statement
+}
+
 func (parser *Parser) parseLetStatement() ast.Statement {
 	statement := &ast.LetStatement{Token: parser.curToken}
 	if !parser.ExpectPeek(token.IDENT) {
@@ -223,11 +383,80 @@ func (parser *Parser) parseLetStatement() ast.Statement {
 	}
 	parser.nextToken()
 	statement.Val = parser.parseExpression(LOWEST)
+	if function, ok := statement.Val.(*ast.FunctionLiteral); ok {
+		function.Name = statement.Id.Value
+	}
+
+	if parser.PeekTokenIsType(token.SEMICOL) {
+		parser.nextToken()
+	}
+
+	return statement
+}
+
+// parseFunctionDeclaration parses fun name(...) { ... }, which is short for
+// let name = fun(...) { ... }.
+func (parser *Parser) parseFunctionDeclaration() ast.Statement {
+	literal := &ast.FunctionLiteral{Token: parser.curToken}
+	statement := &ast.LetStatement{Token: token.Token{Type: token.LET, Literal: "let", Pos: parser.curToken.Pos}}
+	parser.nextToken()
+	statement.Id = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+	literal.Name = statement.Id.Value
+	if !parser.parseFunction(literal) {
+		return nil
+	}
+	statement.Val = literal
+	if parser.PeekTokenIsType(token.SEMICOL) {
+		parser.nextToken()
+	}
+	return statement
+}
+
+// parseImportStatement parses import "path/to/lib.sg" and import lib, which
+// is short for import "lib.sg".
+func (parser *Parser) parseImportStatement() ast.Statement {
+	statement := &ast.ImportStatement{Token: parser.curToken}
+	parser.nextToken()
+	switch parser.curToken.Type {
+	case token.IDENT:
+		statement.Path = parser.curToken.Literal + ".sg"
+	case token.STRING:
+		statement.Path = parser.curToken.Literal
+	default:
+		parser.addError(parser.curToken.Pos, "Expected a module name or path after import, got %s.", parser.curToken.Type)
+		return nil
+	}
+	name := strings.TrimSuffix(path.Base(statement.Path), path.Ext(statement.Path))
+	if tok := lexer.New(name).NextToken(); tok.Type != token.IDENT || tok.Literal != name {
+		parser.addError(parser.curToken.Pos, "can't import %q, %q is not a valid name for the module", statement.Path, name)
+		return nil
+	}
+	statement.Name = &ast.Identifier{Token: parser.curToken, Value: name}
 
 	if parser.PeekTokenIsType(token.SEMICOL) {
 		parser.nextToken()
 	}
+	return statement
+}
 
+func (parser *Parser) parseExportStatement() ast.Statement {
+	statement := &ast.ExportStatement{Token: parser.curToken}
+	parser.nextToken()
+	var declaration ast.Statement
+	switch {
+	case parser.CurTokenIsType(token.LET):
+		declaration = parser.parseLetStatement()
+	case parser.CurTokenIsType(token.FUNCTION) && parser.PeekTokenIsType(token.IDENT):
+		declaration = parser.parseFunctionDeclaration()
+	default:
+		parser.addError(parser.curToken.Pos, "Expected let or a function declaration after export, got %s.", parser.curToken.Type)
+		return nil
+	}
+	let, ok := declaration.(*ast.LetStatement)
+	if !ok {
+		return nil
+	}
+	statement.Let = let
 	return statement
 }
 
@@ -244,6 +473,28 @@ func (parser *Parser) parseReturnStatement() ast.Statement {
 func (parser *Parser) parseExpressionStatement() ast.Statement {
 	statement := &ast.ExpressionStatement{Token: parser.curToken}
 	statement.Expr = parser.parseExpression(LOWEST)
+	if target, ok := statement.Expr.(*ast.IndexExpression); ok {
+		if _, compound := compoundAssignments[parser.peekToken.Type]; compound || parser.PeekTokenIsType(token.SET) {
+			return parser.parseIndexAssignment(statement.Token, target)
+		}
+	}
+
+	if parser.PeekTokenIsType(token.SEMICOL) {
+		parser.nextToken()
+	}
+	return statement
+}
+
+// parseIndexAssignment parses `a[i] = v` and `a[i] op= v` once the target
+// has been parsed.
+func (parser *Parser) parseIndexAssignment(start token.Token, target *ast.IndexExpression) ast.Statement {
+	statement := &ast.SetStatement{Token: start, Target: target}
+	parser.nextToken()
+	if operator, ok := compoundAssignments[parser.curToken.Type]; ok {
+		statement.Operator = operator
+	}
+	parser.nextToken()
+	statement.Val = parser.parseExpression(LOWEST)
 
 	if parser.PeekTokenIsType(token.SEMICOL) {
 		parser.nextToken()
@@ -252,6 +503,11 @@ func (parser *Parser) parseExpressionStatement() ast.Statement {
 }
 
 func (parser *Parser) parseExpression(precedence int) ast.Expression {
+	// every infix operator applied below nests the tree one level deeper
+	defer func(depth int) { parser.depth = depth }(parser.depth)
+	if !parser.enter() {
+		return nil
+	}
 	prefix := parser.prefixParseFns[parser.curToken.Type]
 	if prefix == nil {
 		parser.noPrefixParseFnError(parser.curToken.Type)
@@ -266,11 +522,28 @@ func (parser *Parser) parseExpression(precedence int) ast.Expression {
 			return leftExpr
 		}
 		parser.nextToken()
+		if !parser.enter() {
+			return nil
+		}
 		leftExpr = infix(leftExpr)
 	}
 	return leftExpr
 }
 
+// enter goes one level deeper into the syntax tree and reports false, with
+// an error, once MaxNesting is exceeded.
+func (parser *Parser) enter() bool {
+	parser.depth++
+	if parser.depth <= MaxNesting {
+		return true
+	}
+	if !parser.tooDeep {
+		parser.tooDeep = true
+		parser.addError(parser.curToken.Pos, "program is nested too deeply, the limit is %d levels", MaxNesting)
+	}
+	return false
+}
+
 func (parser *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		Token:    parser.curToken,
@@ -330,6 +603,11 @@ func (parser *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: parser.curToken}
 	block.Statements = []ast.Statement{}
 
+	defer func(depth int) { parser.depth = depth }(parser.depth)
+	if !parser.enter() {
+		return block
+	}
+
 	parser.nextToken()
 
 	for !parser.CurTokenIsType(token.RB) && !parser.CurTokenIsType(token.EOF) {
@@ -339,51 +617,120 @@ func (parser *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		parser.nextToken()
 	}
+	if parser.CurTokenIsType(token.EOF) {
+		parser.addError(block.Token.Pos, "the block opened here is never closed with }")
+	}
 	return block
 }
 
 func (parser *Parser) parseFunctionLiteral() ast.Expression {
 	literal := &ast.FunctionLiteral{Token: parser.curToken}
+	if !parser.parseFunction(literal) {
+		return nil
+	}
+	return literal
+}
 
+// parseFunction parses the parameters and the body of a function, starting
+// before the opening parenthesis.
+func (parser *Parser) parseFunction(literal *ast.FunctionLiteral) bool {
 	if !parser.ExpectPeek(token.LP) {
-		return nil
+		return false
 	}
 	literal.Parameters = parser.parseFunctionParameters()
 
 	if !parser.ExpectPeek(token.LB) {
-		return nil
+		return false
 	}
 	literal.Body = parser.parseBlockStatement()
-	return literal
+	return true
 }
 
-func (parser *Parser) parseFunctionParameters() []*ast.Identifier {
-	var identifiers []*ast.Identifier
+// parseFunctionParameters parses names, name = default and a final ...name.
+// Once a parameter has a default, the ones after it need one as well.
+func (parser *Parser) parseFunctionParameters() []*ast.Parameter {
+	var parameters []*ast.Parameter
 
 	if parser.PeekTokenIsType(token.RP) {
 		parser.nextToken()
-		return identifiers
+		return parameters
 	}
-	parser.nextToken()
-
-	ident := &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
-	identifiers = append(identifiers, ident)
-
-	for parser.PeekTokenIsType(token.COMMA) {
+	seen := make(map[string]bool)
+	defaults := false
+	for {
 		parser.nextToken()
+		parameter := &ast.Parameter{Rest: parser.CurTokenIsType(token.REST)}
+		if parameter.Rest {
+			parser.nextToken()
+		}
+		if !parser.CurTokenIsType(token.IDENT) {
+			parser.addError(parser.curToken.Pos, "Expected a parameter name, got %s.", parser.curToken.Type)
+			return nil
+		}
+		parameter.Name = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+		if seen[parameter.Name.Value] {
+			parser.addError(parser.curToken.Pos, "duplicate parameter %s", parameter.Name.Value)
+		}
+		seen[parameter.Name.Value] = true
+		switch {
+		case parser.PeekTokenIsType(token.SET):
+			if parameter.Rest {
+				parser.addError(parser.peekToken.Pos, "the rest parameter %s can't have a default value", parameter.Name.Value)
+			}
+			parser.nextToken()
+			parser.nextToken()
+			parameter.Default = parser.parseExpression(LOWEST)
+			defaults = true
+		case defaults && !parameter.Rest:
+			parser.addError(parser.curToken.Pos, "parameter %s needs a default value, like the ones before it", parameter.Name.Value)
+		}
+		parameters = append(parameters, parameter)
+		if !parser.PeekTokenIsType(token.COMMA) {
+			break
+		}
+		if parameter.Rest {
+			parser.addError(parser.curToken.Pos, "the rest parameter %s must be the last one", parameter.Name.Value)
+		}
 		parser.nextToken()
-		ident := &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
-		identifiers = append(identifiers, ident)
 	}
 	if !parser.ExpectPeek(token.RP) {
 		return nil
 	}
-	return identifiers
+	return parameters
 }
 
+// parseCallExpression parses the arguments of a call. Arguments passed as
+// name = value come after all the others.
 func (parser *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	expression := &ast.CallExpression{Token: parser.curToken, Function: function}
-	expression.Arguments = parser.parseExpressionList(token.RP)
+	if parser.PeekTokenIsType(token.RP) {
+		parser.nextToken()
+		return expression
+	}
+	named := make(map[string]bool)
+	for {
+		parser.nextToken()
+		if parser.CurTokenIsType(token.IDENT) && parser.PeekTokenIsType(token.SET) {
+			name := &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+			if named[name.Value] {
+				parser.addError(name.Pos(), "argument %s given twice", name.Value)
+			}
+			named[name.Value] = true
+			expression.Names = append(expression.Names, name)
+			parser.nextToken()
+			parser.nextToken()
+		} else if len(expression.Names) > 0 {
+			parser.addError(parser.curToken.Pos, "positional argument after a named one")
+		}
+		expression.Arguments = append(expression.Arguments, parser.parseExpression(LOWEST))
+		if !parser.PeekTokenIsType(token.COMMA) {
+			break
+		}
+		parser.nextToken()
+	}
+	if !parser.ExpectPeek(token.RP) {
+		return nil
+	}
 	return expression
 }
 
@@ -417,18 +764,41 @@ func (parser *Parser) parseArrayLiteral() ast.Expression {
 	return array
 }
 func (parser *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: parser.curToken, Left: left}
+	start := parser.curToken
 	parser.nextToken()
-	exp.Index = parser.parseExpression(LOWEST)
+	var index ast.Expression
+	if !parser.CurTokenIsType(token.COL) {
+		index = parser.parseExpression(LOWEST)
+		if !parser.PeekTokenIsType(token.COL) {
+			if !parser.ExpectPeek(token.RBP) {
+				return nil
+			}
+			return &ast.IndexExpression{Token: start, Left: left, Index: index}
+		}
+		parser.nextToken()
+	}
+	slice := &ast.SliceExpression{Token: start, Left: left, Start: index}
+	if !parser.PeekTokenIsType(token.RBP) {
+		parser.nextToken()
+		slice.End = parser.parseExpression(LOWEST)
+	}
 	if !parser.ExpectPeek(token.RBP) {
 		return nil
 	}
+	return slice
+}
+
+func (parser *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: parser.curToken, Left: left}
+	if !parser.ExpectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Name = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
 	return exp
 }
 
 func (parser *Parser) parseMapLiteral() ast.Expression {
 	mp := &ast.MapLiteral{Token: parser.curToken}
-	mp.Pairs = make(map[ast.Expression]ast.Expression)
 
 	for !parser.PeekTokenIsType(token.RB) {
 		parser.nextToken()
@@ -439,7 +809,7 @@ func (parser *Parser) parseMapLiteral() ast.Expression {
 		}
 		parser.nextToken()
 		value := parser.parseExpression(LOWEST)
-		mp.Pairs[key] = value
+		mp.Pairs = append(mp.Pairs, ast.MapPair{Key: key, Value: value})
 		if !parser.PeekTokenIsType(token.RB) && !parser.ExpectPeek(token.COMMA) {
 			return nil
 		}
@@ -455,29 +825,126 @@ func (parser *Parser) parseForStatement() ast.Statement {
 		return nil
 	}
 	parser.nextToken()
-	if parser.CurTokenIsType(token.LET) && parser.peekToken.Type == token.IDENT {
-		statement.Initializer = parser.parseLetStatement()
-	} else {
-		parser.noPrefixParseFnError(parser.curToken.Type)
-		return nil
+	if parser.CurTokenIsType(token.IDENT) && (parser.PeekTokenIsType(token.IN) || parser.PeekTokenIsType(token.COMMA)) {
+		return parser.parseForInStatement(statement.Token)
+	}
+	// every part of the header may be left out, as in for(;;)
+	if !parser.CurTokenIsType(token.SEMICOL) {
+		statement.Initializer = parser.parseStatement()
+		if !parser.CurTokenIsType(token.SEMICOL) && !parser.ExpectPeek(token.SEMICOL) {
+			return nil
+		}
 	}
 	parser.nextToken()
+	if !parser.CurTokenIsType(token.SEMICOL) {
+		statement.Condition = parser.parseExpression(LOWEST)
+		if !parser.ExpectPeek(token.SEMICOL) {
+			return nil
+		}
+	}
+	parser.nextToken()
+	if !parser.CurTokenIsType(token.RP) {
+		statement.Post = parser.parseStatement()
+		if !parser.ExpectPeek(token.RP) {
+			return nil
+		}
+	}
+	if !parser.ExpectPeek(token.LB) {
+		return nil
+	}
+	statement.Body = parser.parseBlockStatement()
+	if parser.PeekTokenIsType(token.SEMICOL) {
+		parser.nextToken()
+	}
+	return statement
+}
 
-	statement.Condition = parser.parseExpression(LOWEST)
-	if !parser.ExpectPeek(token.SEMICOL) {
+func (parser *Parser) parseForInStatement(forToken token.Token) ast.Statement {
+	statement := &ast.ForInStatement{Token: forToken}
+	statement.Value = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+	if parser.PeekTokenIsType(token.COMMA) {
+		parser.nextToken()
+		if !parser.ExpectPeek(token.IDENT) {
+			return nil
+		}
+		statement.Key = statement.Value
+		statement.Value = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+	}
+	if !parser.ExpectPeek(token.IN) {
 		return nil
 	}
 	parser.nextToken()
-	if parser.CurTokenIsType(token.IDENT) && parser.peekToken.Type == token.SET {
-		statement.Post = parser.parseSetStatement()
-	} else {
-		parser.noPrefixParseFnError(parser.curToken.Type)
+	statement.Iterable = parser.parseExpression(LOWEST)
+	if !parser.ExpectPeek(token.RP) {
+		return nil
+	}
+	if !parser.ExpectPeek(token.LB) {
+		return nil
+	}
+	statement.Body = parser.parseBlockStatement()
+	if parser.PeekTokenIsType(token.SEMICOL) {
+		parser.nextToken()
+	}
+	return statement
+}
+
+func (parser *Parser) parseWhileStatement() ast.Statement {
+	statement := &ast.WhileStatement{Token: parser.curToken}
+	if !parser.ExpectPeek(token.LP) {
 		return nil
 	}
 	parser.nextToken()
+	statement.Condition = parser.parseExpression(LOWEST)
+	if !parser.ExpectPeek(token.RP) {
+		return nil
+	}
+	if !parser.ExpectPeek(token.LB) {
+		return nil
+	}
+	statement.Body = parser.parseBlockStatement()
+	if parser.PeekTokenIsType(token.SEMICOL) {
+		parser.nextToken()
+	}
+	return statement
+}
+
+func (parser *Parser) parseTryStatement() ast.Statement {
+	statement := &ast.TryStatement{Token: parser.curToken}
 	if !parser.ExpectPeek(token.LB) {
 		return nil
 	}
 	statement.Body = parser.parseBlockStatement()
+
+	if parser.PeekTokenIsType(token.CATCH) {
+		parser.nextToken()
+		if parser.PeekTokenIsType(token.LP) {
+			parser.nextToken()
+			if !parser.ExpectPeek(token.IDENT) {
+				return nil
+			}
+			statement.Param = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+			if !parser.ExpectPeek(token.RP) {
+				return nil
+			}
+		}
+		if !parser.ExpectPeek(token.LB) {
+			return nil
+		}
+		statement.Catch = parser.parseBlockStatement()
+	}
+	if parser.PeekTokenIsType(token.FINALLY) {
+		parser.nextToken()
+		if !parser.ExpectPeek(token.LB) {
+			return nil
+		}
+		statement.Finally = parser.parseBlockStatement()
+	}
+	if statement.Catch == nil && statement.Finally == nil {
+		parser.addError(statement.Token.Pos, "try needs a catch or a finally block")
+		return nil
+	}
+	if parser.PeekTokenIsType(token.SEMICOL) {
+		parser.nextToken()
+	}
 	return statement
 }
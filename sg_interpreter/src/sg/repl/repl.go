@@ -4,40 +4,177 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
 	"sg_interpreter/src/sg/Item"
 	"sg_interpreter/src/sg/evaluator"
 	"sg_interpreter/src/sg/lexer"
 	"sg_interpreter/src/sg/parser"
+	"sg_interpreter/src/sg/token"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 const PROMPT = ">> "
+const CONTINUATION_PROMPT = ".. "
+
+const HELP = `Enter statements to evaluate them, unclosed brackets continue on the next line.
+Commands (a command also discards an unfinished entry):
+  :help          show this message
+  :env           list the variables defined in the session
+  :reset         forget every variable
+  :load <file>   run a file in the session
+  :history       list the entries evaluated so far
+  :redo [n]      evaluate history entry n again, the last entry by default
+  :quit          leave the REPL
+`
+
+type session struct {
+	out     io.Writer
+	env     *Item.Scope
+	history []string
+}
 
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
-	env := Item.NewScope()
-	fmt.Printf(PROMPT)
+	s := &session{out: out, env: Item.NewScope()}
 
-	line := ""
+	input := ""
 	for {
-		scanned := scanner.Scan()
-		line += scanner.Text()
-		if !scanned {
-			l := lexer.New(line)
-			p := parser.New(l)
-			program := p.ParseProgram()
-			if len(p.Errors()) != 0 {
-				printParserErrors(out, p.Errors())
-				continue
+		if input == "" {
+			io.WriteString(out, PROMPT)
+		} else {
+			io.WriteString(out, CONTINUATION_PROMPT)
+		}
+		if !scanner.Scan() {
+			if input != "" {
+				s.eval(input)
 			}
+			io.WriteString(out, "\n")
+			return
+		}
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
 
-			evaluated := evaluator.Eval(program, env)
-			if evaluated != nil {
-				//check stuff
+		if strings.HasPrefix(trimmed, ":") {
+			// commands also get the user out of an entry that never closes
+			input = ""
+			if !s.command(trimmed) {
+				return
 			}
+			continue
+		}
+		if input == "" && trimmed == "" {
+			continue
+		}
+
+		input += line + "\n"
+		if openBrackets(input) > 0 {
+			continue
+		}
+		s.history = append(s.history, strings.TrimRight(input, "\n"))
+		s.eval(input)
+		input = ""
+	}
+}
+
+// command runs a meta-command and reports whether the session goes on.
+func (s *session) command(line string) bool {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ":quit", ":exit", ":q":
+		return false
+	case ":help":
+		io.WriteString(s.out, HELP)
+	case ":env":
+		names := make([]string, 0, len(s.env.Mp))
+		for name := range s.env.Mp {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(s.out, "%s = %s\n", name, s.env.Mp[name].Output())
+		}
+	case ":reset":
+		s.env = Item.NewScope()
+	case ":load":
+		if len(fields) != 2 {
+			io.WriteString(s.out, "usage: :load <file>\n")
+			break
+		}
+		source, err := os.ReadFile(fields[1])
+		if err != nil {
+			fmt.Fprintln(s.out, "Error opening file:", err)
+			break
+		}
+		s.evalSource(string(source), fields[1])
+	case ":history":
+		for i, entry := range s.history {
+			fmt.Fprintf(s.out, "%4d  %s\n", i+1, strings.ReplaceAll(entry, "\n", "\n      "))
+		}
+	case ":redo":
+		s.redo(fields)
+	default:
+		fmt.Fprintf(s.out, "unknown command %s, try :help\n", fields[0])
+	}
+	return true
+}
+
+func (s *session) redo(fields []string) {
+	if len(s.history) == 0 {
+		io.WriteString(s.out, "history is empty\n")
+		return
+	}
+	n := len(s.history)
+	if len(fields) > 1 {
+		var err error
+		n, err = strconv.Atoi(fields[1])
+		if err != nil || n < 1 || n > len(s.history) {
+			fmt.Fprintf(s.out, "no history entry %s\n", fields[1])
 			return
 		}
+	}
+	entry := s.history[n-1]
+	io.WriteString(s.out, entry+"\n")
+	s.history = append(s.history, entry)
+	s.eval(entry)
+}
 
+func (s *session) eval(input string) {
+	evaluated := s.evalSource(input, "<repl>")
+	if evaluated != nil && evaluated != evaluator.NULL && evaluated.Type() != Item.ERROR_ITEM {
+		io.WriteString(s.out, evaluated.Output()+"\n")
+	}
+}
+
+func (s *session) evalSource(input string, file string) Item.Item {
+	p := parser.New(lexer.NewWithFile(input, file))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, p.Errors())
+		return nil
+	}
+	evaluated := evaluator.Eval(program, s.env)
+	if err, ok := evaluated.(*Item.Error); ok {
+		io.WriteString(s.out, err.Traceback()+"\n")
+	}
+	return evaluated
+}
+
+// openBrackets counts the brackets input leaves open, so an entry like
+// `if (x) {` keeps reading lines until its block is closed.
+func openBrackets(input string) int {
+	l := lexer.New(input)
+	depth := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LP, token.LB, token.LBP:
+			depth++
+		case token.RP, token.RB, token.RBP:
+			depth--
+		}
 	}
+	return depth
 }
 
 const ERROR_MESSAGE = `
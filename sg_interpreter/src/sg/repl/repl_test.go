@@ -0,0 +1,84 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// run feeds input to a session and returns everything it printed.
+func run(input string) string {
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	return out.String()
+}
+
+func TestSessions(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"continued lines", "let f = fun(x) {\n  x * 2\n}\nf(4)\n",
+			">> .. .. >> 8\n>> \n"},
+		{"blank lines", "\n  \n1\n", ">> >> >> 1\n>> \n"},
+		{"parse error", "let = 1\nlet a = 2\na\n",
+			">> " + ERROR_MESSAGE + " parser errors:\n" +
+				"\t<repl>:1:5: Expected next token to be IDENT, got =.\n" +
+				"\t<repl>:1:5: no prefix parse function for = found\n" +
+				">> >> 2\n>> \n"},
+		{"runtime error", "let a = 1\na + \"b\"\na\n",
+			">> >> ERROR: <repl>:1:3: type mismatch: INTEGER + STRING\n>> 1\n>> \n"},
+		{"unfinished at the end", "puts(1\n",
+			">> .. " + ERROR_MESSAGE + " parser errors:\n\t<repl>:2:1: Expected next token to be ), got EOF.\n\n"},
+		{"command ends an unfinished entry", "let x = [1,\n:env\nx\n",
+			">> .. >> ERROR: <repl>:1:1: identifier not found: x\n>> \n"},
+		{"env", "let b = 2\nlet a = [1]\n:env\n",
+			">> >> >> a = [1]\nb = 2\n>> \n"},
+		{"reset", "let a = 1\n:reset\na\n:env\n",
+			">> >> >> ERROR: <repl>:1:1: identifier not found: a\n>> >> \n"},
+		{"history", "let n = 0\nif (true) {\n  n\n}\n:history\n",
+			">> >> .. .. 0\n>>    1  let n = 0\n   2  if (true) {\n        n\n      }\n>> \n"},
+		{"redo", "let n = 0\nn += 1\n:redo 2\n:redo\nn\n:history\n",
+			">> >> >> n += 1\n>> n += 1\n>> 3\n>> " +
+				"   1  let n = 0\n   2  n += 1\n   3  n += 1\n   4  n += 1\n   5  n\n>> \n"},
+		{"redo nothing", ":redo\n1\n:redo 0\n:redo 2\n:redo x\n",
+			">> history is empty\n>> 1\n>> no history entry 0\n>> no history entry 2\n>> no history entry x\n>> \n"},
+		{"quit", "1\n:quit\n2\n", ">> 1\n>> "},
+		{"unknown command", ":nope\n", ">> unknown command :nope, try :help\n>> \n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := run(tt.input); got != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.sg")
+	if err := os.WriteFile(lib, []byte("let loaded = 5\n\nloaded + \"x\""), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.sg")
+	got := run(":load " + lib + "\nloaded\n:load\n:load " + missing + "\n")
+	want := ">> ERROR: " + lib + ":3:8: type mismatch: INTEGER + STRING\n" +
+		">> 5\n>> usage: :load <file>\n>> Error opening file: open " + missing + ": no such file or directory\n>> \n"
+	if got != want {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestEnvPrintsValuesThatContainThemselves(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("let a = [1]\nlet h = {}\nh[\"h\"] = h\npush(a, a)\n:env\n"), &out)
+	for _, want := range []string{"a = [1, [...]]\n", "h = {h: {...}}\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output %q does not contain %q", out.String(), want)
+		}
+	}
+}
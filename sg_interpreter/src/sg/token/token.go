@@ -1,10 +1,13 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 const (
 	// Identifiers + literals
 	INT    = "INT"
+	FLOAT  = "FLOAT"
 	IDENT  = "IDENT"
 	STRING = "STRING"
 
@@ -19,11 +22,37 @@ const (
 	GT     = ">"
 	EQ     = "=="
 	NOT_EQ = "!="
+	MOD    = "%"
+	LT_EQ  = "<="
+	GT_EQ  = ">="
+	AND    = "&&"
+	OR     = "||"
+
+	BIT_AND = "&"
+	BIT_OR  = "|"
+	BIT_XOR = "^"
+	BIT_NOT = "~"
+	SHL     = "<<"
+	SHR     = ">>"
+
+	// Compound assignment
+	PLUS_SET    = "+="
+	MINUS_SET   = "-="
+	STAR_SET    = "*="
+	SLASH_SET   = "/="
+	MOD_SET     = "%="
+	BIT_AND_SET = "&="
+	BIT_OR_SET  = "|="
+	BIT_XOR_SET = "^="
+	SHL_SET     = "<<="
+	SHR_SET     = ">>="
 
 	// Delimiters
 	COMMA   = ","
 	SEMICOL = ";"
 	COL     = ":"
+	DOT     = "."
+	REST    = "..."
 	LP      = "("
 	RP      = ")"
 	LB      = "{"
@@ -39,7 +68,17 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	FOR      = "FOR"
+	WHILE    = "WHILE"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 	RETURN   = "RETURN"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
 
 	//Miscellanios types
 	ILLEGAL = "ILLEGAL"
@@ -49,6 +88,29 @@ const (
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+// Position is a location in a source file. Line and Column start at 1,
+// the zero Position means the location is unknown.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return p.File
+	}
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
 }
 
 var keywords = map[string]TokenType{
@@ -63,6 +125,16 @@ var keywords = map[string]TokenType{
 	"return":   RETURN,
 	"ret":      RETURN,
 	"for":      FOR,
+	"while":    WHILE,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"import":   IMPORT,
+	"export":   EXPORT,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
 }
 
 func FindIdent(ident string) TokenType {
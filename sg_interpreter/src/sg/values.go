@@ -0,0 +1,532 @@
+package sg
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sg_interpreter/src/sg/Item"
+	"sg_interpreter/src/sg/evaluator"
+	"sort"
+)
+
+// maxDepth bounds how deeply values are converted, so a Go value that
+// refers to itself fails instead of overflowing the stack.
+const maxDepth = 1000
+
+var (
+	itemType   = reflect.TypeOf((*Item.Item)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// ToItem converts a Go value to an SG value:
+//
+//   - nil and nil pointers, slices and maps become null
+//   - booleans, numbers and strings, including named types based on them,
+//     become booleans, integers, floats and strings; *big.Int and unsigned
+//     values too large for an int64 become big integers
+//   - slices and arrays become arrays, maps become hashes
+//   - structs become hashes from field names to values. Only exported fields
+//     are converted, a `sg:"name"` tag renames a field and `sg:"-"` skips it
+//   - pointers are followed
+//   - functions become builtins, see Register
+//   - errors become error values, as caught by a try statement
+//   - Item.Item values are kept as they are
+func ToItem(value interface{}) (Item.Item, error) {
+	return toItem("", reflect.ValueOf(value), 0)
+}
+
+func toItem(name string, value reflect.Value, depth int) (Item.Item, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("value nested more than %d levels deep, does it contain itself?", maxDepth)
+	}
+	if !value.IsValid() {
+		return evaluator.NULL, nil
+	}
+	if value.Type().Implements(itemType) && value.Kind() != reflect.Interface {
+		if value.Kind() == reflect.Ptr && value.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return value.Interface().(Item.Item), nil
+	}
+	if value.Type() == bigIntType {
+		if value.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return normalize(new(big.Int).Set(value.Interface().(*big.Int))), nil
+	}
+	if value.Type().Implements(errorType) && value.Kind() != reflect.Interface {
+		if value.Kind() == reflect.Ptr && value.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return &Item.ErrorValue{Kind: Item.GENERIC_ERROR, Message: value.Interface().(error).Error()}, nil
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Item.Integer{Value: value.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if value.Uint() > math.MaxInt64 {
+			return &Item.BigInt{Value: new(big.Int).SetUint64(value.Uint())}, nil
+		}
+		return &Item.Integer{Value: int64(value.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Item.Float{Value: value.Float()}, nil
+	case reflect.String:
+		return &Item.String{Value: value.String()}, nil
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return toItem(name, value.Elem(), depth+1)
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return evaluator.NULL, nil
+		}
+		elements := make([]Item.Item, value.Len())
+		for i := range elements {
+			element, err := toItem("", value.Index(i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return &Item.Array{Elements: elements, Len: int64(len(elements)), Capacity: int64(len(elements))}, nil
+	case reflect.Map:
+		if value.IsNil() {
+			return evaluator.NULL, nil
+		}
+		// Go maps have no order, the keys are sorted to give the hash one
+		pairs := make([]Item.HashPair, 0, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			key, err := toItem("", iter.Key(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			element, err := toItem("", iter.Value(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, Item.HashPair{Key: key, Value: element})
+		}
+		sort.Slice(pairs, func(i, j int) bool { return keyLess(pairs[i].Key, pairs[j].Key) })
+		hash := Item.NewHash()
+		for _, pair := range pairs {
+			if err := setPair(hash, pair.Key, pair.Value); err != nil {
+				return nil, err
+			}
+		}
+		return hash, nil
+	case reflect.Struct:
+		hash := Item.NewHash()
+		for _, field := range structFields(value.Type()) {
+			element, err := toItem("", value.FieldByIndex(field.index), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			setPair(hash, &Item.String{Value: field.name}, element)
+		}
+		return hash, nil
+	case reflect.Func:
+		if value.IsNil() {
+			return evaluator.NULL, nil
+		}
+		if fn, ok := value.Interface().(func(args ...Item.Item) Item.Item); ok {
+			return &Item.Builtin{Fn: fn}, nil
+		}
+		if fn, ok := value.Interface().(Item.BuiltinFunction); ok {
+			return &Item.Builtin{Fn: fn}, nil
+		}
+		return wrapFunc(name, value), nil
+	}
+	return nil, fmt.Errorf("can't convert %s to an SG value", value.Type())
+}
+
+func normalize(value *big.Int) Item.Item {
+	if value.IsInt64() {
+		return &Item.Integer{Value: value.Int64()}
+	}
+	return &Item.BigInt{Value: value}
+}
+
+func setPair(hash *Item.Hash, key, value Item.Item) error {
+	hashable, err := Item.ToKey(key)
+	if err != nil {
+		return fmt.Errorf("%s", err.Message)
+	}
+	hash.Set(hashable, value)
+	return nil
+}
+
+// keyLess orders numbers by value and everything else by type and text.
+func keyLess(a, b Item.Item) bool {
+	if a, ok := a.(*Item.Integer); ok {
+		if b, ok := b.(*Item.Integer); ok {
+			return a.Value < b.Value
+		}
+	}
+	if a, ok := a.(*Item.Float); ok {
+		if b, ok := b.(*Item.Float); ok {
+			return a.Value < b.Value
+		}
+	}
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	return a.Output() < b.Output()
+}
+
+type structField struct {
+	name  string
+	index []int
+}
+
+// structFields lists the fields of a struct type SG sees, with their names.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("sg"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, structField{name: name, index: field.Index})
+	}
+	return fields
+}
+
+// FromItem converts an SG value to a Go value. Integers become int64, or
+// *big.Int when they don't fit, floats float64, strings string, booleans
+// bool and null nil. Arrays become []interface{}, hashes
+// map[string]interface{} when every key is a string and
+// map[interface{}]interface{} otherwise, with array keys turned into Go
+// arrays like [2]interface{}. Errors become an *Error. Other
+// values, like functions, are returned as they are. Use Decode to convert
+// to a particular Go type instead.
+func FromItem(item Item.Item) interface{} {
+	switch item := item.(type) {
+	case nil, *Item.Null:
+		return nil
+	case *Item.Integer:
+		return item.Value
+	case *Item.BigInt:
+		return new(big.Int).Set(item.Value)
+	case *Item.Float:
+		return item.Value
+	case *Item.String:
+		return item.Value
+	case *Item.Boolean:
+		return item.Value
+	case *Item.Error:
+		return newError(item.Value())
+	case *Item.ErrorValue:
+		return newError(item)
+	case *Item.Array:
+		elements := make([]interface{}, item.Len)
+		for i := range elements {
+			elements[i] = FromItem(item.Elements[i])
+		}
+		return elements
+	case *Item.Hash:
+		stringKeys := make(map[string]interface{}, item.Len())
+		for _, pair := range item.Pairs() {
+			key, ok := pair.Key.(*Item.String)
+			if !ok {
+				return hashFromItem(item)
+			}
+			stringKeys[key.Value] = FromItem(pair.Value)
+		}
+		return stringKeys
+	}
+	return item
+}
+
+func hashFromItem(hash *Item.Hash) map[interface{}]interface{} {
+	pairs := make(map[interface{}]interface{}, hash.Len())
+	for _, pair := range hash.Pairs() {
+		pairs[keyFromItem(pair.Key)] = FromItem(pair.Value)
+	}
+	return pairs
+}
+
+// keyFromItem converts a hash key like FromItem, except that arrays become
+// Go arrays, as slices can't be map keys.
+func keyFromItem(key Item.Item) interface{} {
+	arr, ok := key.(*Item.Array)
+	if !ok {
+		return FromItem(key)
+	}
+	elements := reflect.New(reflect.ArrayOf(int(arr.Len), reflect.TypeOf((*interface{})(nil)).Elem())).Elem()
+	for i := 0; i < int(arr.Len); i++ {
+		elements.Index(i).Set(reflect.ValueOf(keyFromItem(arr.Elements[i])))
+	}
+	return elements.Interface()
+}
+
+// Decode stores an SG value in the Go value target points to, converting it
+// to the target's type the opposite way ToItem does. Hashes decode into
+// structs by field name, and keys the struct has no field for are an error.
+func Decode(item Item.Item, target interface{}) error {
+	pointer := reflect.ValueOf(target)
+	if pointer.Kind() != reflect.Ptr || pointer.IsNil() {
+		return fmt.Errorf("Decode needs a non-nil pointer, got %T", target)
+	}
+	value, err := fromItem(item, pointer.Type().Elem(), 0)
+	if err != nil {
+		return err
+	}
+	pointer.Elem().Set(value)
+	return nil
+}
+
+// fromItem converts item to a Go value of type t.
+func fromItem(item Item.Item, t reflect.Type, depth int) (reflect.Value, error) {
+	if depth > maxDepth {
+		return reflect.Value{}, fmt.Errorf("value nested more than %d levels deep", maxDepth)
+	}
+	if item == nil {
+		item = evaluator.NULL
+	}
+	if reflect.TypeOf(item).AssignableTo(t) && t.Kind() != reflect.Interface || t == itemType {
+		return reflect.ValueOf(item), nil
+	}
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		if item == evaluator.NULL {
+			return reflect.Zero(t), nil
+		}
+		return reflect.ValueOf(FromItem(item)).Convert(t), nil
+	}
+	if item == evaluator.NULL {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+	}
+	if t == bigIntType {
+		if value, ok := toBigInt(item); ok {
+			return reflect.ValueOf(value), nil
+		}
+		return reflect.Value{}, cantUse(item, t)
+	}
+	if t == errorType {
+		if err, ok := item.(*Item.ErrorValue); ok {
+			return reflect.ValueOf(newError(err)), nil
+		}
+		return reflect.Value{}, cantUse(item, t)
+	}
+
+	value := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Bool:
+		boolean, ok := item.(*Item.Boolean)
+		if !ok {
+			return reflect.Value{}, cantUse(item, t)
+		}
+		value.SetBool(boolean.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := toBigInt(item)
+		if !ok {
+			return reflect.Value{}, cantUse(item, t)
+		}
+		if !integer.IsInt64() || value.OverflowInt(integer.Int64()) {
+			return reflect.Value{}, fmt.Errorf("%s does not fit in %s", integer, t)
+		}
+		value.SetInt(integer.Int64())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		integer, ok := toBigInt(item)
+		if !ok {
+			return reflect.Value{}, cantUse(item, t)
+		}
+		if integer.Sign() < 0 || !integer.IsUint64() || value.OverflowUint(integer.Uint64()) {
+			return reflect.Value{}, fmt.Errorf("%s does not fit in %s", integer, t)
+		}
+		value.SetUint(integer.Uint64())
+	case reflect.Float32, reflect.Float64:
+		switch number := item.(type) {
+		case *Item.Float:
+			value.SetFloat(number.Value)
+		case *Item.Integer:
+			value.SetFloat(float64(number.Value))
+		case *Item.BigInt:
+			f, _ := new(big.Float).SetInt(number.Value).Float64()
+			value.SetFloat(f)
+		default:
+			return reflect.Value{}, cantUse(item, t)
+		}
+	case reflect.String:
+		str, ok := item.(*Item.String)
+		if !ok {
+			return reflect.Value{}, cantUse(item, t)
+		}
+		value.SetString(str.Value)
+	case reflect.Ptr:
+		element, err := fromItem(item, t.Elem(), depth+1)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value = reflect.New(t.Elem())
+		value.Elem().Set(element)
+	case reflect.Slice, reflect.Array:
+		array, ok := item.(*Item.Array)
+		if !ok {
+			return reflect.Value{}, cantUse(item, t)
+		}
+		if t.Kind() == reflect.Slice {
+			value = reflect.MakeSlice(t, int(array.Len), int(array.Len))
+		} else if int64(t.Len()) != array.Len {
+			return reflect.Value{}, fmt.Errorf("can't use an ARRAY of %d elements as %s", array.Len, t)
+		}
+		for i := 0; i < int(array.Len); i++ {
+			element, err := fromItem(array.Elements[i], t.Elem(), depth+1)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value.Index(i).Set(element)
+		}
+	case reflect.Map:
+		hash, ok := item.(*Item.Hash)
+		if !ok {
+			return reflect.Value{}, cantUse(item, t)
+		}
+		value = reflect.MakeMapWithSize(t, hash.Len())
+		for _, pair := range hash.Pairs() {
+			key, err := fromItem(pair.Key, t.Key(), depth+1)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			element, err := fromItem(pair.Value, t.Elem(), depth+1)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value.SetMapIndex(key, element)
+		}
+	case reflect.Struct:
+		hash, ok := item.(*Item.Hash)
+		if !ok {
+			return reflect.Value{}, cantUse(item, t)
+		}
+		fields := make(map[string][]int)
+		for _, field := range structFields(t) {
+			fields[field.name] = field.index
+		}
+		for _, pair := range hash.Pairs() {
+			key, ok := pair.Key.(*Item.String)
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("can't use a %s key for a field of %s", pair.Key.Type(), t)
+			}
+			index, ok := fields[key.Value]
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("%s has no field %q", t, key.Value)
+			}
+			field := value.FieldByIndex(index)
+			element, err := fromItem(pair.Value, field.Type(), depth+1)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("field %q: %w", key.Value, err)
+			}
+			field.Set(element)
+		}
+	default:
+		return reflect.Value{}, cantUse(item, t)
+	}
+	return value, nil
+}
+
+func toBigInt(item Item.Item) (*big.Int, bool) {
+	switch item := item.(type) {
+	case *Item.Integer:
+		return big.NewInt(item.Value), true
+	case *Item.BigInt:
+		return new(big.Int).Set(item.Value), true
+	}
+	return nil, false
+}
+
+func cantUse(item Item.Item, t reflect.Type) error {
+	return fmt.Errorf("can't use %s as %s", item.Type(), t)
+}
+
+// wrapFunc turns a Go function into a builtin. Arguments are converted to
+// the parameter types with fromItem, and the results back with toItem: no
+// result gives null, one result its value and several an array of them. A
+// last result of type error becomes an SG error when it isn't nil, and so
+// does a panic.
+func wrapFunc(name string, fn reflect.Value) *Item.Builtin {
+	t := fn.Type()
+	if name == "" {
+		name = "function"
+	} else {
+		name = "`" + name + "`"
+	}
+	required := t.NumIn()
+	if t.IsVariadic() {
+		required--
+	}
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+
+	return &Item.Builtin{Fn: func(args ...Item.Item) (result Item.Item) {
+		if t.IsVariadic() && len(args) < required {
+			return &Item.Error{Kind: Item.ARGUMENT_ERROR, Message: fmt.Sprintf("Wrong number of arguments to %s! Expected at least %d. Received=%d", name, required, len(args))}
+		}
+		if !t.IsVariadic() && len(args) != required {
+			return &Item.Error{Kind: Item.ARGUMENT_ERROR, Message: fmt.Sprintf("Wrong number of arguments to %s! Expected=%d. Received=%d", name, required, len(args))}
+		}
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var paramType reflect.Type
+			if i >= required {
+				paramType = t.In(required).Elem()
+			} else {
+				paramType = t.In(i)
+			}
+			value, err := fromItem(arg, paramType, 0)
+			if err != nil {
+				return &Item.Error{Kind: Item.TYPE_ERROR, Message: fmt.Sprintf("Argument %d to %s: %s", i+1, name, err)}
+			}
+			in[i] = value
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				result = &Item.Error{Message: fmt.Sprintf("%s panicked: %v", name, r)}
+			}
+		}()
+		out := fn.Call(in)
+
+		if returnsError {
+			if err := out[len(out)-1]; !err.IsNil() {
+				return &Item.Error{Message: err.Interface().(error).Error()}
+			}
+			out = out[:len(out)-1]
+		}
+		items := make([]Item.Item, len(out))
+		for i, value := range out {
+			item, err := toItem("", value, 0)
+			if err != nil {
+				return &Item.Error{Message: fmt.Sprintf("Result of %s: %s", name, err)}
+			}
+			items[i] = item
+		}
+		switch len(items) {
+		case 0:
+			return evaluator.NULL
+		case 1:
+			return items[0]
+		}
+		return &Item.Array{Elements: items, Len: int64(len(items)), Capacity: int64(len(items))}
+	}}
+}
@@ -0,0 +1,231 @@
+package sg
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sg_interpreter/src/sg/Item"
+	"sg_interpreter/src/sg/evaluator"
+	"sg_interpreter/src/sg/lexer"
+	"sg_interpreter/src/sg/parser"
+	"strings"
+	"testing"
+)
+
+// evalItem returns the SG value of source.
+func evalItem(t *testing.T, source string) Item.Item {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q: %v", source, p.Errors())
+	}
+	result := evaluator.Eval(program, Item.NewScope())
+	if err, ok := result.(*Item.Error); ok {
+		t.Fatalf("%q: %s", source, err.Output())
+	}
+	return result
+}
+
+type person struct {
+	Name    string `sg:"name"`
+	Age     int
+	Secret  string `sg:"-"`
+	private int
+}
+
+type node struct {
+	Next *node
+}
+
+type celsius float64
+
+func TestToItem(t *testing.T) {
+	loop := &node{}
+	loop.Next = loop
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	tests := []struct {
+		name  string
+		value interface{}
+		want  Item.ItemType
+		out   string // the Output of the value, or the error
+	}{
+		{"nil", nil, Item.NULL_ITEM, "null"},
+		{"nil slice", []int(nil), Item.NULL_ITEM, "null"},
+		{"nil pointer", (*person)(nil), Item.NULL_ITEM, "null"},
+		{"int", -5, Item.INTEGER_ITEM, "-5"},
+		{"largest int64", int64(math.MaxInt64), Item.INTEGER_ITEM, "9223372036854775807"},
+		{"uint64 past int64", uint64(math.MaxUint64), Item.BIGINT_ITEM, "18446744073709551615"},
+		{"small big.Int", big.NewInt(7), Item.INTEGER_ITEM, "7"},
+		{"big.Int", huge, Item.BIGINT_ITEM, "123456789012345678901234567890"},
+		{"named float", celsius(21.5), Item.FLOAT_ITEM, "21.5"},
+		{"bool", true, Item.BOOLEAN_ITEM, "true"},
+		{"nested slices", [][]int{{1}, {2, 3}, nil}, Item.ARRAY_ITEM, "[[1], [2, 3], null]"},
+		{"array", [2]string{"a", "b"}, Item.ARRAY_ITEM, "[a, b]"},
+		{"map of slices", map[string][]int{"b": {2}, "a": {1}}, Item.HASH_ITEM, "{a: [1], b: [2]}"},
+		{"map with int keys", map[int]string{10: "x", 2: "y"}, Item.HASH_ITEM, "{2: y, 10: x}"},
+		{"struct with tags", person{Name: "Ann", Age: 30, Secret: "s", private: 1}, Item.HASH_ITEM, "{name: Ann, Age: 30}"},
+		{"pointer to struct", &person{Name: "Bo"}, Item.HASH_ITEM, "{name: Bo, Age: 0}"},
+		{"error", errors.New("broken"), Item.ERROR_VALUE_ITEM, ""},
+		{"item", &Item.String{Value: "kept"}, Item.STRING_ITEM, "kept"},
+		{"channel", make(chan int), "", "can't convert chan int to an SG value"},
+		{"containing itself", loop, "", "value nested more than 1000 levels deep, does it contain itself?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, err := ToItem(tt.value)
+			if tt.want == "" {
+				if err == nil || err.Error() != tt.out {
+					t.Errorf("got %v, %v, want the error %q", item, err, tt.out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if item.Type() != tt.want || (tt.out != "" && item.Output() != tt.out) {
+				t.Errorf("got %s %s, want %s %s", item.Type(), item.Output(), tt.want, tt.out)
+			}
+		})
+	}
+}
+
+func TestFromItem(t *testing.T) {
+	tests := []struct {
+		source string
+		want   interface{}
+	}{
+		{"5", int64(5)},
+		{"1.5", 1.5},
+		{`"text"`, "text"},
+		{"false", false},
+		{"if (false) { 1 }", nil},
+		{`[1, ["a", [true]]]`, []interface{}{int64(1), []interface{}{"a", []interface{}{true}}}},
+		{`{"a": [1], "b": {"c": 2}}`, map[string]interface{}{"a": []interface{}{int64(1)}, "b": map[string]interface{}{"c": int64(2)}}},
+		{`{1: "one", "two": 2}`, map[interface{}]interface{}{int64(1): "one", "two": int64(2)}},
+		{`{[1, [2]]: "array"}`, map[interface{}]interface{}{[2]interface{}{int64(1), [1]interface{}{int64(2)}}: "array"}},
+	}
+	for _, tt := range tests {
+		if got := FromItem(evalItem(t, tt.source)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.source, got, tt.want)
+		}
+	}
+
+	n, ok := FromItem(evalItem(t, "9223372036854775807 + 1")).(*big.Int)
+	if !ok || n.String() != "9223372036854775808" {
+		t.Errorf("got %v, want a *big.Int of 2**63", n)
+	}
+	err, ok := FromItem(&Item.ErrorValue{Kind: Item.VALUE_ERROR, Message: "bad"}).(*Error)
+	if !ok || err.Kind != Item.VALUE_ERROR || err.Message != "bad" {
+		t.Errorf("got %#v, want an *Error", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	tests := []struct {
+		source string
+		target interface{} // a pointer to the zero value of the type to decode into
+		want   interface{}
+		err    string
+	}{
+		{"5", new(int8), int8(5), ""},
+		{"300", new(int8), nil, "300 does not fit in int8"},
+		{"-1", new(uint), nil, "-1 does not fit in uint"},
+		{"123456789012345678901234567890", new(int64), nil, "123456789012345678901234567890 does not fit in int64"},
+		{"123456789012345678901234567890", new(*big.Int), huge, ""},
+		{"7", new(*big.Int), big.NewInt(7), ""},
+		{"2", new(float64), 2.0, ""},
+		{"2.5", new(int), nil, "can't use FLOAT as int"},
+		{`"a"`, new(int), nil, "can't use STRING as int"},
+		{"1", new(string), nil, "can't use INTEGER as string"},
+		{"1", new(bool), nil, "can't use INTEGER as bool"},
+		{"1", new(interface{}), int64(1), ""},
+		{"[[1, 2], [3]]", new([][]int), [][]int{{1, 2}, {3}}, ""},
+		{"[1, 2]", new([2]int), [2]int{1, 2}, ""},
+		{"[1, 2]", new([3]int), nil, "can't use an ARRAY of 2 elements as [3]int"},
+		{`[1, "a"]`, new([]int), nil, "can't use STRING as int"},
+		{"[1]", new(map[string]int), nil, "can't use ARRAY as map[string]int"},
+		{`{"a": [1], "b": []}`, new(map[string][]int), map[string][]int{"a": {1}, "b": {}}, ""},
+		{`{1: "x"}`, new(map[string]string), nil, "can't use INTEGER as string"},
+		{`{"name": "Ann", "Age": 30}`, new(person), person{Name: "Ann", Age: 30}, ""},
+		{`{"name": "Ann"}`, new(*person), &person{Name: "Ann"}, ""},
+		{`{"Name": "Ann"}`, new(person), nil, `sg.person has no field "Name"`},
+		{`{"Secret": "s"}`, new(person), nil, `sg.person has no field "Secret"`},
+		{`{"Age": "old"}`, new(person), nil, `field "Age": can't use STRING as int`},
+		{`{1: 2}`, new(person), nil, "can't use a INTEGER key for a field of sg.person"},
+		{"if (false) { 1 }", new(*int), (*int)(nil), ""},
+		{"if (false) { 1 }", new(int), nil, "can't use NULL as int"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s as %T", tt.source, tt.target), func(t *testing.T) {
+			err := Decode(evalItem(t, tt.source), tt.target)
+			got := reflect.ValueOf(tt.target).Elem().Interface()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("got %#v, %v, want the error %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	var n int
+	if err := Decode(evalItem(t, "1"), n); err == nil {
+		t.Error("decoding into a non-pointer succeeded")
+	}
+}
+
+func TestWrapFunc(t *testing.T) {
+	str := func(s string) Item.Item { return &Item.String{Value: s} }
+	integer := func(n int64) Item.Item { return &Item.Integer{Value: n} }
+	tests := []struct {
+		name string
+		fn   interface{}
+		args []Item.Item
+		want string // the Output of the result, or of the error
+	}{
+		{"no results", func() {}, nil, "null"},
+		{"several results", func(a, b int) (int, int) { return a / b, a % b }, []Item.Item{integer(7), integer(2)}, "[3, 1]"},
+		{"nil error", func() (string, error) { return "ok", nil }, nil, "ok"},
+		{"error", func() (string, error) { return "", errors.New("broken") }, nil, "ERROR: broken"},
+		{"only an error", func() error { return nil }, nil, "null"},
+		{"variadic", func(sep string, parts ...string) string { return strings.Join(parts, sep) }, []Item.Item{str("-"), str("a"), str("b")}, "a-b"},
+		{"variadic without the rest", func(sep string, parts ...string) int { return len(parts) }, []Item.Item{str("-")}, "0"},
+		{"variadic without enough", func(sep string, parts ...string) int { return len(parts) }, nil,
+			"ERROR: Wrong number of arguments to function! Expected at least 1. Received=0"},
+		{"variadic of the wrong type", func(parts ...string) int { return len(parts) }, []Item.Item{str("a"), integer(1)},
+			"ERROR: Argument 2 to function: can't use INTEGER as string"},
+		{"too many arguments", func(n int) int { return n }, []Item.Item{integer(1), integer(2)},
+			"ERROR: Wrong number of arguments to function! Expected=1. Received=2"},
+		{"argument too large", func(n int8) int8 { return n }, []Item.Item{integer(1000)},
+			"ERROR: Argument 1 to function: 1000 does not fit in int8"},
+		{"panic", func() int { panic("boom") }, nil, "ERROR: function panicked: boom"},
+		{"result that can't be converted", func() chan int { return nil }, nil,
+			"ERROR: Result of function: can't convert chan int to an SG value"},
+		{"big result", func() uint64 { return math.MaxUint64 }, nil, "18446744073709551615"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, err := ToItem(tt.fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			builtin, ok := item.(*Item.Builtin)
+			if !ok {
+				t.Fatalf("got %T, want a builtin", item)
+			}
+			if got := builtin.Fn(tt.args...).Output(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,680 @@
+package vm
+
+import (
+	"fmt"
+	"sg_interpreter/src/sg/Item"
+	"sg_interpreter/src/sg/ast"
+	"sg_interpreter/src/sg/code"
+	"sg_interpreter/src/sg/compiler"
+	"sg_interpreter/src/sg/evaluator"
+	"sg_interpreter/src/sg/token"
+)
+
+const StackSize = 1 << 16
+const MaxFrames = 1 << 14
+
+type Frame struct {
+	cl     *Item.Closure
+	ip     int
+	locals []*Item.Cell
+	base   int
+}
+
+func NewFrame(cl *Item.Closure, base int) *Frame {
+	return &Frame{
+		cl:     cl,
+		ip:     -1,
+		locals: make([]*Item.Cell, cl.Fn.NumLocals),
+		base:   base,
+	}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+type VM struct {
+	constants []Item.Item   // those of the program and of the modules it imported
+	globals   *Item.Globals // those of the program, each module has its own
+
+	stack []Item.Item
+	sp    int // always points to the next free slot, the top is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	lastPopped Item.Item
+	result     Item.Item
+
+	modules *Item.Modules
+
+	handlers []handler // the try statements being run, innermost last
+
+	fault error // a fault of the vm inside a function called by a builtin or a module
+}
+
+// handler is where an error raised inside a try statement continues.
+type handler struct {
+	framesIndex int
+	sp          int
+	catchPos    int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &Item.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Positions:    bytecode.Positions,
+		NumLocals:    bytecode.NumLocals,
+	}
+	globals := Item.NewGlobals(bytecode.GlobalNames)
+	mainFrame := NewFrame(&Item.Closure{Fn: mainFn, Globals: globals}, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     globals,
+		stack:       make([]Item.Item, StackSize),
+		frames:      frames,
+		framesIndex: 1,
+		modules:     Item.NewModules(Item.NewScope(), nil),
+	}
+}
+
+// SetModules sets where imported modules are found and the globals they
+// see.
+func (vm *VM) SetModules(modules *Item.Modules) {
+	vm.modules = modules
+}
+
+// Result is the value of the last expression statement, the value returned
+// at the top level, or the *Item.Error that stopped the program.
+func (vm *VM) Result() Item.Item {
+	if vm.result != nil {
+		return vm.result
+	}
+	return vm.lastPopped
+}
+
+// SetGlobal binds a value to a global the program refers to but does not
+// define itself. It does nothing if the program never uses the name.
+func (vm *VM) SetGlobal(name string, value Item.Item) {
+	for i, globalName := range vm.globals.Names {
+		if globalName == name {
+			vm.globals.Values[i] = value
+		}
+	}
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow: more than %d nested calls", MaxFrames)
+	}
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) push(item Item.Item) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	vm.stack[vm.sp] = item
+	vm.sp++
+	return nil
+}
+
+func (vm *VM) pop() Item.Item {
+	item := vm.stack[vm.sp-1]
+	vm.sp--
+	return item
+}
+
+// Run executes the program. The returned error reports faults of the vm
+// itself; errors raised by the program are available through Result.
+func (vm *VM) Run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("internal error: %v", r)
+		}
+	}()
+	return vm.run(1)
+}
+
+// run executes instructions until the frame at index stop-1 returns. For the
+// main program, stop is 1 and run goes on until the program ends.
+func (vm *VM) run(stop int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.framesIndex >= stop && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		frame := vm.currentFrame()
+		frame.ip++
+
+		ip = frame.ip
+		ins = frame.Instructions()
+		op = code.Opcode(ins[ip])
+
+		var result Item.Item
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			result = vm.constants[constIndex]
+
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+			continue
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpGreaterEqual, code.OpLessEqual:
+			right := vm.pop()
+			left := vm.pop()
+			result = vm.executeBinaryOperation(op, left, right)
+
+		case code.OpTrue:
+			result = evaluator.TRUE
+		case code.OpFalse:
+			result = evaluator.FALSE
+		case code.OpNull:
+			result = evaluator.NULL
+
+		case code.OpBang:
+			result = evaluator.PrefixOperation("!", vm.pop())
+		case code.OpMinus:
+			result = evaluator.PrefixOperation("-", vm.pop())
+		case code.OpBitNot:
+			result = evaluator.PrefixOperation("~", vm.pop())
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+			continue
+		case code.OpSkipDefault:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			pos := int(code.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+			if frame.locals[localIndex] != nil {
+				frame.ip = pos - 1
+			}
+			continue
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+			continue
+
+		case code.OpIter:
+			iterable := vm.pop()
+			iterator, ok := Item.NewIterator(iterable)
+			if ok {
+				result = iterator
+			} else {
+				result = newKindError(Item.TYPE_ERROR, "cannot iterate over %s", iterable.Type())
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			numVariables := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+			iterator := vm.stack[vm.sp-1].(*Item.Iterator)
+			key, value, ok := iterator.Next()
+			if !ok {
+				frame.ip = pos - 1
+				continue
+			}
+			if numVariables == 2 {
+				if err := vm.push(key); err != nil {
+					return err
+				}
+				result = value
+			} else if iterator.Keys {
+				result = key
+			} else {
+				result = value
+			}
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			globals := frame.cl.Globals
+			result = globals.Values[globalIndex]
+			if result == nil {
+				result = newKindError(Item.NAME_ERROR, "identifier not found: "+globals.Names[globalIndex])
+			}
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			globals := frame.cl.Globals
+			if globals.Values[globalIndex] == nil {
+				result = newKindError(Item.NAME_ERROR, "Variable %s not defined in current scope!", globals.Names[globalIndex])
+				break
+			}
+			globals.Values[globalIndex] = vm.pop()
+			continue
+		case code.OpDefineGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			frame.cl.Globals.Values[globalIndex] = vm.pop()
+			continue
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			result = cellValue(frame.locals[localIndex])
+		case code.OpSetLocal:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			if frame.locals[localIndex] == nil {
+				frame.locals[localIndex] = &Item.Cell{}
+			}
+			frame.locals[localIndex].Value = vm.pop()
+			continue
+		case code.OpDefineLocal:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			frame.locals[localIndex] = &Item.Cell{Value: vm.pop()}
+			continue
+		case code.OpLocalCell:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			if frame.locals[localIndex] == nil {
+				frame.locals[localIndex] = &Item.Cell{}
+			}
+			result = frame.locals[localIndex]
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			result = cellValue(frame.cl.Free[freeIndex])
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			frame.cl.Free[freeIndex].Value = vm.pop()
+			continue
+		case code.OpFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			result = frame.cl.Free[freeIndex]
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			elements := make([]Item.Item, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+			result = &Item.Array{Elements: elements, Len: int64(numElements), Capacity: int64(numElements)}
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			result = vm.buildHash(vm.sp-numElements, vm.sp)
+			vm.sp -= numElements
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			result = evaluator.IndexOperation(left, index)
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			result = evaluator.SliceOperation(vm.pop(), start, end)
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			result = evaluator.SetIndexOperation(left, index, value)
+			if result == nil {
+				continue
+			}
+
+		case code.OpCall, code.OpCallNamed:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			var names []string
+			if op == code.OpCallNamed {
+				constant := vm.constants[code.ReadUint16(ins[ip+2:])].(*Item.Array)
+				frame.ip += 2
+				names = make([]string, constant.Len)
+				for i := range names {
+					names[i] = constant.Elements[i].(*Item.String).Value
+				}
+			}
+			called, err := vm.callFunction(numArgs, names)
+			if err != nil {
+				return err
+			}
+			if called {
+				continue
+			}
+			result = vm.pop()
+
+		case code.OpReturnValue, code.OpReturn:
+			var returnValue Item.Item = evaluator.NULL
+			if op == code.OpReturnValue {
+				returnValue = vm.pop()
+			}
+			if vm.framesIndex == 1 {
+				vm.result = returnValue
+				return nil
+			}
+			returning := vm.popFrame()
+			vm.sp = returning.base
+			result = returnValue
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+			result = vm.buildClosure(int(constIndex), numFree)
+
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			path := vm.constants[constIndex].(*Item.String).Value
+			result = evaluator.ImportModule(vm.modules, path, frame.cl.Fn.Positions.Lookup(ip), vm.runModule)
+			if vm.fault != nil {
+				return vm.fault
+			}
+		case code.OpMember:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			result = evaluator.MemberOperation(vm.pop(), vm.constants[constIndex].(*Item.String).Value)
+
+		case code.OpTry:
+			catchPos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			vm.handlers = append(vm.handlers, handler{framesIndex: vm.framesIndex, sp: vm.sp, catchPos: catchPos})
+			continue
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+			continue
+		case code.OpThrow:
+			result = evaluator.ThrowOperation(vm.pop())
+
+		default:
+			return fmt.Errorf("unknown opcode %d", op)
+		}
+
+		if err, ok := result.(*Item.Error); ok {
+			if !err.Pos.IsValid() {
+				err.Pos = frame.cl.Fn.Positions.Lookup(ip)
+			}
+			if len(vm.handlers) == 0 || vm.handlers[len(vm.handlers)-1].framesIndex < stop {
+				// the frames below stop belong to an outer run, which
+				// goes on unwinding once the builtin returns the error
+				outer := stop - 1
+				if outer < 1 {
+					outer = 1
+				}
+				err.Trace = append(err.Trace, vm.stackTrace()[:vm.framesIndex-outer]...)
+				vm.result = err
+				if stop > 1 {
+					vm.sp = vm.frames[stop-1].base
+					vm.framesIndex = stop - 1
+				}
+				return nil
+			}
+			// unwind to the innermost try statement, the trace keeps the
+			// calls left on the way
+			h := vm.handlers[len(vm.handlers)-1]
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+			err.Trace = append(err.Trace, vm.stackTrace()[:vm.framesIndex-h.framesIndex]...)
+			vm.framesIndex = h.framesIndex
+			vm.sp = h.sp
+			vm.currentFrame().ip = h.catchPos - 1
+			result = err.Value()
+		}
+		if err := vm.push(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var operators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+
+	code.OpGreaterEqual: ">=",
+	code.OpLessEqual:    "<=",
+	code.OpMod:          "%",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode, left, right Item.Item) Item.Item {
+	leftInt, leftOk := left.(*Item.Integer)
+	rightInt, rightOk := right.(*Item.Integer)
+	if leftOk && rightOk {
+		l, r := leftInt.Value, rightInt.Value
+		switch op {
+		// results that overflow are left to the evaluator, which promotes
+		// them to big integers
+		case code.OpAdd:
+			if sum := l + r; (sum > l) == (r > 0) {
+				return &Item.Integer{Value: sum}
+			}
+		case code.OpSub:
+			if difference := l - r; (difference < l) == (r > 0) {
+				return &Item.Integer{Value: difference}
+			}
+		case code.OpMul:
+			if -1<<31 < l && l < 1<<31 && -1<<31 < r && r < 1<<31 {
+				return &Item.Integer{Value: l * r}
+			}
+		case code.OpEqual:
+			return nativeBoolToBoolean(l == r)
+		case code.OpNotEqual:
+			return nativeBoolToBoolean(l != r)
+		case code.OpGreaterThan:
+			return nativeBoolToBoolean(l > r)
+		case code.OpLessThan:
+			return nativeBoolToBoolean(l < r)
+		case code.OpGreaterEqual:
+			return nativeBoolToBoolean(l >= r)
+		case code.OpLessEqual:
+			return nativeBoolToBoolean(l <= r)
+		}
+	}
+	return evaluator.InfixOperation(left, operators[op], right)
+}
+
+// callFunction calls the function below the numArgs arguments on the stack,
+// the last len(names) of which were passed by name.
+func (vm *VM) callFunction(numArgs int, names []string) (bool, error) {
+	base := vm.sp - 1 - numArgs
+	switch callee := vm.stack[base].(type) {
+	case *Item.Closure:
+		args := vm.stack[base+1 : vm.sp]
+		parameters := callee.Fn.Parameters
+		if len(names) > 0 || numArgs != callee.Fn.NumParameters || (numArgs > 0 && parameters[numArgs-1].Rest) {
+			values, err := evaluator.BindArguments(parameters, args, names)
+			if err != nil {
+				vm.stack[base] = err
+				vm.sp = base + 1
+				return false, nil
+			}
+			args = values
+		}
+		if vm.framesIndex >= MaxFrames {
+			vm.stack[base] = newKindError(Item.RECURSION_ERROR, "stack overflow: more than %d nested calls", MaxFrames)
+			vm.sp = base + 1
+			return false, nil
+		}
+		frame := NewFrame(callee, base)
+		// parameters left to their default keep no cell, which makes the
+		// function compute the default
+		for i, arg := range args {
+			if arg != nil {
+				frame.locals[i] = &Item.Cell{Value: arg}
+			}
+		}
+		vm.sp = base
+		return true, vm.pushFrame(frame)
+	case *Item.Builtin:
+		if len(names) > 0 {
+			vm.stack[base] = newKindError(Item.ARGUMENT_ERROR, "builtin functions take no named arguments")
+			vm.sp = base + 1
+			return false, nil
+		}
+		args := make([]Item.Item, numArgs)
+		copy(args, vm.stack[base+1:vm.sp])
+		vm.stack[base] = callee.Call(vm.call, args...)
+		if vm.fault != nil {
+			return false, vm.fault
+		}
+		vm.sp = base + 1
+		return false, nil
+	default:
+		vm.stack[base] = newKindError(Item.TYPE_ERROR, "not a function: %s", callee.Type())
+		vm.sp = base + 1
+		return false, nil
+	}
+}
+
+// call runs a function a builtin got as an argument, or an imported module,
+// on top of the stack of the running program.
+func (vm *VM) call(fn Item.Item, args ...Item.Item) Item.Item {
+	if vm.sp+1+len(args) > StackSize {
+		return newKindError(Item.RECURSION_ERROR, "stack overflow")
+	}
+	base := vm.sp
+	vm.stack[base] = fn
+	copy(vm.stack[base+1:], args)
+	vm.sp = base + 1 + len(args)
+	called, err := vm.callFunction(len(args), nil)
+	if err == nil && called {
+		err = vm.run(vm.framesIndex)
+	}
+	if err != nil {
+		// the program stops once the builtin returns
+		vm.fault = err
+		vm.sp = base
+		return newError("%s", err)
+	}
+	if vm.result != nil {
+		result := vm.result
+		vm.result = nil
+		return result
+	}
+	return vm.pop()
+}
+
+// stackTrace lists the active calls, innermost first, with the position of
+// the call instruction each caller is paused at.
+func (vm *VM) stackTrace() []Item.StackFrame {
+	var trace []Item.StackFrame
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		caller := vm.frames[i-1]
+		trace = append(trace, Item.StackFrame{
+			Function: Item.FunctionName(vm.frames[i].cl.Fn.Name),
+			CallPos:  caller.cl.Fn.Positions.Lookup(caller.ip),
+		})
+	}
+	return trace
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) Item.Item {
+	hash := Item.NewHash()
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, err := Item.ToKey(key)
+		if err != nil {
+			return err
+		}
+		hash.Set(hashKey, value)
+	}
+	return hash
+}
+
+func (vm *VM) buildClosure(constIndex int, numFree int) Item.Item {
+	function, ok := vm.constants[constIndex].(*Item.CompiledFunction)
+	if !ok {
+		return newKindError(Item.TYPE_ERROR, "not a function: %+v", vm.constants[constIndex])
+	}
+	free := make([]*Item.Cell, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i].(*Item.Cell)
+	}
+	vm.sp -= numFree
+	return &Item.Closure{Fn: function, Free: free, Globals: vm.currentFrame().cl.Globals}
+}
+
+// runModule compiles the program of an imported file and calls it, so that it
+// runs in a frame of its own like in the evaluator. The globals it doesn't
+// define itself are those the host provides.
+func (vm *VM) runModule(program *ast.Program, file string, from token.Position) (Item.Variables, *Item.Error) {
+	frame := Item.StackFrame{Function: "<module " + file + ">", CallPos: from}
+	comp := compiler.NewModule(vm.constants)
+	if err := comp.CompileModule(program); err != nil {
+		err := newKindError(Item.IMPORT_ERROR, "can't import %q: %s", file, err)
+		err.Trace = append(err.Trace, frame)
+		return nil, err
+	}
+	bytecode := comp.Bytecode()
+	vm.constants = bytecode.Constants
+
+	globals := Item.NewGlobals(bytecode.GlobalNames)
+	for i, name := range globals.Names {
+		if value, ok := vm.modules.Globals.Get(name); ok {
+			globals.Values[i] = value
+		}
+	}
+	fn := &Item.CompiledFunction{
+		Name:         frame.Function,
+		Instructions: bytecode.Instructions,
+		Positions:    bytecode.Positions,
+		NumLocals:    bytecode.NumLocals,
+	}
+	if err, ok := vm.call(&Item.Closure{Fn: fn, Globals: globals}).(*Item.Error); ok {
+		return nil, err
+	}
+	return globals, nil
+}
+
+func cellValue(cell *Item.Cell) Item.Item {
+	if cell == nil || cell.Value == nil {
+		return newKindError(Item.NAME_ERROR, "identifier used before it was defined")
+	}
+	return cell.Value
+}
+
+func nativeBoolToBoolean(b bool) *Item.Boolean {
+	if b {
+		return evaluator.TRUE
+	}
+	return evaluator.FALSE
+}
+
+func newError(format string, a ...interface{}) *Item.Error {
+	return &Item.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func newKindError(kind string, format string, a ...interface{}) *Item.Error {
+	return &Item.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}